@@ -5,12 +5,15 @@ import (
 	"os"
 	"os/signal"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/xenitab/mqtt-log-stdout/pkg/config"
+	"github.com/xenitab/mqtt-log-stdout/pkg/discovery"
 	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
 	"github.com/xenitab/mqtt-log-stdout/pkg/message"
 	"github.com/xenitab/mqtt-log-stdout/pkg/metrics"
 	"github.com/xenitab/mqtt-log-stdout/pkg/mqtt"
 	"github.com/xenitab/mqtt-log-stdout/pkg/status"
+	"github.com/xenitab/mqtt-log-stdout/pkg/tail"
 )
 
 var (
@@ -44,16 +47,43 @@ func run(cfg config.Client) error {
 	stopChan := h.NewStopChannel()
 	defer signal.Stop(stopChan)
 
-	statusClient := newStatusClient(cfg)
+	statusClient, err := newStatusClient(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to create status client: %q\n", err)
+		return err
+	}
+
+	registry, registerer, err := newMetricsRegistry(cfg)
+	if err != nil {
+		statusClient.Error("Unable to create metrics registry", "error", err)
+		return err
+	}
+
 	messageClient := newMessageClient()
-	metricsServer := newMetricsServer(cfg, statusClient)
-	mqttClient := newMqttClient(cfg, statusClient, messageClient)
+	tailBroker := newTailBroker(cfg, registerer)
+	mqttClient := newMqttClient(cfg, statusClient, messageClient, tailBroker, registerer)
+	healthCheckers := []h.ServiceHealthChecker{mqttClient, messageClient}
+	reloader := newReloader(cfg, statusClient, mqttClient)
+	debugStateReporters := []h.ServiceDebugStateReporter{mqttClient, reloader}
+	var subscriptionManager h.ServiceSubscriptionManager
+	if cfg.AdminAPI {
+		subscriptionManager = mqttClient
+	}
+
+	metricsServer := newMetricsServer(cfg, statusClient, registry, healthCheckers, debugStateReporters, subscriptionManager, tailBroker)
 
 	h.StartService(ctx, errGroup, metricsServer)
 	h.StartService(ctx, errGroup, mqttClient)
 
-	stoppedBy := h.WaitForStop(stopChan, ctx)
-	statusClient.Print(fmt.Sprintf("Application stopping, initiated by: %s", stoppedBy), nil)
+	if cfg.ConfigWatchInterval > 0 {
+		errGroup.Go(func() error {
+			config.WatchFile(ctx, cfg.ConfigFile, cfg.ConfigWatchInterval, func() { reloader.reload("config file change") })
+			return nil
+		})
+	}
+
+	stoppedBy := h.WaitForStop(stopChan, ctx, func() { reloader.reload("os.Signal (hangup)") })
+	statusClient.Info("Application stopping", "initiated_by", stoppedBy)
 
 	cancel()
 
@@ -76,9 +106,14 @@ func newConfigClient(version, revision, created string) (config.Client, error) {
 	return config.NewClient(opts)
 }
 
-func newStatusClient(cfg config.Client) status.Client {
+func newStatusClient(cfg config.Client) (status.Client, error) {
 	opts := status.Options{
-		ClientID: cfg.ClientID,
+		ClientID:   cfg.ClientID,
+		Level:      cfg.LogLevel,
+		Format:     cfg.LogFormat,
+		Output:     cfg.StatusOutput,
+		OutputFile: cfg.StatusOutputFile,
+		Tag:        cfg.StatusTag,
 	}
 
 	return status.NewClient(opts)
@@ -90,30 +125,170 @@ func newMessageClient() message.Client {
 	return message.NewClient(opts)
 }
 
-func newMetricsServer(cfg config.Client, statusClient status.Client) *metrics.Server {
+func newMetricsRegistry(cfg config.Client) (*prometheus.Registry, prometheus.Registerer, error) {
+	opts := metrics.RegistryOptions{
+		Namespace:   cfg.MetricsNamespace,
+		ConstLabels: cfg.MetricsConstLabels,
+		Version:     Version,
+		Revision:    Revision,
+		Created:     Created,
+	}
+
+	return metrics.NewRegistry(opts)
+}
+
+func newMetricsServer(cfg config.Client, statusClient status.Client, registry *prometheus.Registry, healthCheckers []h.ServiceHealthChecker, debugStateReporters []h.ServiceDebugStateReporter, subscriptionManager h.ServiceSubscriptionManager, tailBroker *tail.Broker) *metrics.Server {
 	opts := metrics.Options{
-		Address:      cfg.MetricsAddress,
-		Port:         cfg.MetricsPort,
-		StatusClient: statusClient,
+		Address:               cfg.MetricsAddress,
+		Port:                  cfg.MetricsPort,
+		StatusClient:          statusClient,
+		Registry:              registry,
+		HealthCheckers:        healthCheckers,
+		DebugEnabled:          cfg.DebugEndpoints,
+		DebugAddress:          cfg.DebugAddress,
+		DebugPort:             cfg.DebugPort,
+		DebugStateReporters:   debugStateReporters,
+		TLSCertFile:           cfg.MetricsTLSCertFile,
+		TLSKeyFile:            cfg.MetricsTLSKeyFile,
+		TLSClientCAFile:       cfg.MetricsTLSClientCAFile,
+		BasicAuthUsername:     cfg.MetricsBasicAuthUsername,
+		BasicAuthPassword:     cfg.MetricsBasicAuthPassword,
+		BearerToken:           cfg.MetricsBearerToken,
+		BasicAuthPasswordFile: cfg.MetricsBasicAuthPasswordFile,
+		BearerTokenFile:       cfg.MetricsBearerTokenFile,
+		SubscriptionManager:   subscriptionManager,
+		TailBroker:            tailBroker,
+		ReadTimeout:           cfg.MetricsReadTimeout,
+		WriteTimeout:          cfg.MetricsWriteTimeout,
+		IdleTimeout:           cfg.MetricsIdleTimeout,
+		LivenessThreshold:     cfg.MetricsLivenessThreshold,
 	}
 
 	return metrics.NewServer(opts)
 }
 
-func newMqttClient(cfg config.Client, statusClient status.Client, messageClient message.Client) *mqtt.Client {
-	opts := mqtt.Options{
-		BrokerAddresses: cfg.BrokerAddresses,
-		Topic:           cfg.Topic,
-		QoS:             cfg.QoS,
-		ClientID:        cfg.ClientID,
-		Username:        cfg.Username,
-		Password:        cfg.Password,
-		CleanSession:    cfg.CleanSession,
-		KeepAlive:       cfg.KeepAlive,
-		ConnectTimeout:  cfg.ConnectTimeout,
-		StatusClient:    statusClient,
-		MessageClient:   messageClient,
+// newTailBroker returns nil if the tail endpoint isn't enabled
+func newTailBroker(cfg config.Client, registerer prometheus.Registerer) *tail.Broker {
+	if !cfg.TailEndpoint {
+		return nil
+	}
+
+	opts := tail.Options{
+		BufferSize: cfg.TailBufferSize,
+		MaxClients: cfg.TailMaxClients,
+		Registerer: registerer,
+	}
+
+	return tail.NewBroker(opts)
+}
+
+func newMqttClient(cfg config.Client, statusClient status.Client, messageClient message.Client, tailBroker *tail.Broker, registerer prometheus.Registerer) *mqtt.Client {
+	var messageObservers []mqtt.MessageObserver
+	if tailBroker != nil {
+		messageObservers = append(messageObservers, tailBroker)
 	}
 
+	opts := newMqttOptions(cfg, statusClient)
+	opts.MessageObservers = messageObservers
+	opts.Registerer = registerer
+	opts.MessageClient = messageClient
+	opts.BrokerDiscovery = newBrokerDiscovery(cfg)
+	opts.BrokerDiscoveryInterval = cfg.BrokerDiscoveryInterval
+
 	return mqtt.NewClient(opts)
 }
+
+// newCredentialsProvider returns nil if neither the Azure IoT Hub profile nor OAuth2 is configured,
+// the mqtt client uses the username and password (files) instead
+func newCredentialsProvider(cfg config.Client, statusClient status.Client) mqtt.CredentialsProvider {
+	if cfg.Profile == config.ProfileAzureIoTHub {
+		opts := mqtt.SASTokenOptions{
+			HostName:            cfg.ProfileHost,
+			DeviceID:            cfg.ClientID,
+			SharedAccessKey:     cfg.AzureSharedAccessKey,
+			SharedAccessKeyFile: cfg.AzureSharedAccessKeyFile,
+			SharedAccessKeyName: cfg.AzureSharedAccessKeyName,
+			TTL:                 cfg.AzureSASTokenTTL,
+			StatusClient:        statusClient,
+		}
+
+		return mqtt.NewSASTokenCredentials(opts)
+	}
+
+	if cfg.OAuth2TokenURL == "" {
+		return nil
+	}
+
+	opts := mqtt.OAuth2Options{
+		TokenURL:         cfg.OAuth2TokenURL,
+		ClientID:         cfg.OAuth2ClientID,
+		ClientSecret:     cfg.OAuth2ClientSecret,
+		ClientSecretFile: cfg.OAuth2ClientSecretFile,
+		Scopes:           cfg.OAuth2Scopes,
+		Audience:         cfg.OAuth2Audience,
+		Username:         cfg.Username,
+		RefreshBefore:    cfg.OAuth2RefreshBefore,
+		StatusClient:     statusClient,
+	}
+
+	return mqtt.NewOAuth2Credentials(opts)
+}
+
+// newBrokerDiscovery returns nil if neither a SRV record nor a DNS name is configured
+func newBrokerDiscovery(cfg config.Client) mqtt.BrokerDiscoverer {
+	if cfg.BrokerSRVRecord == "" && cfg.BrokerDNSName == "" {
+		return nil
+	}
+
+	opts := discovery.Options{
+		SRVRecord: cfg.BrokerSRVRecord,
+		Host:      cfg.BrokerDNSName,
+		Port:      cfg.BrokerPort,
+		Scheme:    cfg.BrokerDiscoveryScheme,
+	}
+
+	return discovery.NewClient(opts)
+}
+
+// newMqttOptions returns the mqtt options from the config, also used to reconnect when the config is reloaded
+func newMqttOptions(cfg config.Client, statusClient status.Client) mqtt.Options {
+	return mqtt.Options{
+		BrokerAddresses:          cfg.BrokerAddresses,
+		Topic:                    cfg.Topic,
+		QoS:                      cfg.QoS,
+		ClientID:                 cfg.ClientID,
+		Username:                 cfg.Username,
+		Password:                 cfg.Password,
+		UsernameFile:             cfg.UsernameFile,
+		PasswordFile:             cfg.PasswordFile,
+		CredentialsProvider:      newCredentialsProvider(cfg, statusClient),
+		TLSCAFile:                cfg.TLSCAFile,
+		TLSCertFile:              cfg.TLSCertFile,
+		TLSKeyFile:               cfg.TLSKeyFile,
+		TLSALPNProtocols:         cfg.TLSALPNProtocols,
+		TLSInsecureSkipVerify:    cfg.TLSInsecureSkipVerify,
+		WillTopic:                cfg.WillTopic,
+		WillPayload:              cfg.WillPayload,
+		WillQoS:                  cfg.WillQoS,
+		WillRetained:             cfg.WillRetained,
+		PresenceMessages:         cfg.PresenceMessages,
+		Version:                  Version,
+		RetainedMessages:         cfg.RetainedMessages,
+		MessageEnvelope:          cfg.MessageEnvelope,
+		CleanSession:             cfg.CleanSession,
+		SessionStoreDirectory:    cfg.SessionStoreDirectory,
+		KeepAlive:                cfg.KeepAlive,
+		ConnectTimeout:           cfg.ConnectTimeout,
+		ConnectRetry:             cfg.ConnectRetry,
+		ConnectRetryDeadline:     cfg.ConnectRetryDeadline,
+		ReconnectInitialInterval: cfg.ReconnectInitialInterval,
+		ReconnectMaxInterval:     cfg.ReconnectMaxInterval,
+		ReconnectJitter:          cfg.ReconnectJitter,
+		ReconnectMaxAttempts:     cfg.ReconnectMaxAttempts,
+		MetricsTopicDepth:        cfg.MetricsTopicDepth,
+		MetricsTopicMaxLabels:    cfg.MetricsTopicMaxLabels,
+		LatencyTimestampField:    cfg.LatencyTimestampField,
+		StalenessThreshold:       cfg.StalenessThreshold,
+		StatusClient:             statusClient,
+	}
+}
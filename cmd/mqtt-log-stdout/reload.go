@@ -0,0 +1,165 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/xenitab/mqtt-log-stdout/pkg/config"
+	"github.com/xenitab/mqtt-log-stdout/pkg/mqtt"
+	"github.com/xenitab/mqtt-log-stdout/pkg/status"
+)
+
+// connectionFields are the config fields applied by reconnecting the mqtt client
+var connectionFields = map[string]bool{
+	"BrokerAddresses": true, "BrokerPort": true, "Username": true, "Password": true, "UsernameFile": true, "PasswordFile": true,
+	"KeepAlive": true, "ConnectTimeout": true, "CleanSession": true,
+	"OAuth2TokenURL": true, "OAuth2ClientID": true, "OAuth2ClientSecret": true, "OAuth2ClientSecretFile": true,
+	"OAuth2Scopes": true, "OAuth2Audience": true, "OAuth2RefreshBefore": true,
+	"TLSCAFile": true, "TLSCertFile": true, "TLSKeyFile": true, "TLSALPNProtocols": true, "TLSInsecureSkipVerify": true,
+	"Profile": true, "ProfileHost": true, "AzureSharedAccessKey": true, "AzureSharedAccessKeyFile": true,
+	"AzureSharedAccessKeyName": true, "AzureSASTokenTTL": true,
+}
+
+// reloadAction is how a changed config field is applied by reload()
+type reloadAction int
+
+const (
+	// actionApply is used for the fields applied directly, like the log level
+	actionApply reloadAction = iota
+	// actionResubscribe is used for the topic filter and QoS, swapped by subscribing to the new topic before the old one is removed
+	actionResubscribe
+	// actionReconnect is used for the connection settings, applied by reconnecting the mqtt client
+	actionReconnect
+	// actionRestart is used for the fields that require a restart
+	actionRestart
+)
+
+// reloadActionFor returns how the changed field is applied
+func reloadActionFor(change string, newCfg config.Client) reloadAction {
+	switch {
+	case change == "LogLevel":
+		return actionApply
+	case change == "Topic" || change == "QoS":
+		return actionResubscribe
+	case change == "BrokerPort" && newCfg.BrokerDNSName != "":
+		// The brokers discovered using the DNS name use the port from startup
+		return actionRestart
+	case connectionFields[change]:
+		return actionReconnect
+	default:
+		return actionRestart
+	}
+}
+
+// reloader reloads the config on SIGHUP or when the config file changes, applying the changes that don't require a restart.
+// It also reports the effective config in /debug/state.
+type reloader struct {
+	cfg          config.Client
+	mu           sync.Mutex
+	statusClient status.Client
+	mqttClient   *mqtt.Client
+}
+
+func newReloader(cfg config.Client, statusClient status.Client, mqttClient *mqtt.Client) *reloader {
+	return &reloader{
+		cfg:          cfg,
+		statusClient: statusClient,
+		mqttClient:   mqttClient,
+	}
+}
+
+// reload rejects the new config if it isn't valid, otherwise the log level is changed, the topic is resubscribed
+// to and the mqtt client reconnects if the connection settings changed. Other changes are reported as requiring a restart.
+func (r *reloader) reload(initiatedBy string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	newCfg, err := r.cfg.Reload()
+	if err != nil {
+		r.statusClient.Error("Config reload rejected", "initiated_by", initiatedBy, "error", err)
+		return
+	}
+
+	changes := config.Changes(r.cfg, newCfg)
+	if len(changes) == 0 {
+		r.statusClient.Info("Config reloaded without changes", "initiated_by", initiatedBy)
+		return
+	}
+
+	var applied, restartRequired []string
+	var topicChanges, connectionChanges []string
+	for _, change := range changes {
+		switch reloadActionFor(change, newCfg) {
+		case actionApply:
+			err := r.setLogLevel(newCfg.LogLevel)
+			if err != nil {
+				r.statusClient.Error("Unable to change log level", "log_level", newCfg.LogLevel, "error", err)
+				continue
+			}
+
+			r.cfg.LogLevel = newCfg.LogLevel
+			applied = append(applied, change)
+		case actionResubscribe:
+			topicChanges = append(topicChanges, change)
+		case actionReconnect:
+			connectionChanges = append(connectionChanges, change)
+		default:
+			restartRequired = append(restartRequired, change)
+		}
+	}
+
+	if len(topicChanges) > 0 {
+		err := r.mqttClient.SetTopic(newCfg.Topic, newCfg.QoS)
+		if err != nil {
+			r.statusClient.Error("Unable to subscribe to the reloaded topic", "topic", newCfg.Topic, "qos", newCfg.QoS, "error", err)
+		} else {
+			r.cfg.Topic = newCfg.Topic
+			r.cfg.QoS = newCfg.QoS
+			applied = append(applied, topicChanges...)
+		}
+	}
+
+	if len(connectionChanges) > 0 {
+		copyFields(&r.cfg, newCfg, connectionChanges)
+		r.mqttClient.Reconnect(newMqttOptions(r.cfg, r.statusClient))
+		applied = append(applied, connectionChanges...)
+	}
+
+	r.statusClient.Info("Config reloaded", "initiated_by", initiatedBy, "applied", applied)
+
+	if len(restartRequired) > 0 {
+		r.statusClient.Warn("Config changes require a restart to be applied", "changes", restartRequired)
+	}
+}
+
+// copyFields copies the named fields from src to dst
+func copyFields(dst *config.Client, src config.Client, fields []string) {
+	dstValue := reflect.ValueOf(dst).Elem()
+	srcValue := reflect.ValueOf(src)
+	for _, field := range fields {
+		dstValue.FieldByName(field).Set(srcValue.FieldByName(field))
+	}
+}
+
+func (r *reloader) setLogLevel(level string) error {
+	levelSetter, ok := r.statusClient.(status.LevelSetter)
+	if !ok {
+		return nil
+	}
+
+	return levelSetter.SetLevel(level)
+}
+
+// DebugStateName returns the name of the config in debug state reports
+func (r *reloader) DebugStateName() string {
+	return "config"
+}
+
+// DebugState returns the effective config (including the reloaded changes) with the secrets redacted
+func (r *reloader) DebugState() interface{} {
+	r.mu.Lock()
+	cfg := r.cfg
+	r.mu.Unlock()
+
+	return cfg.DebugState()
+}
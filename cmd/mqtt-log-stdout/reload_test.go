@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xenitab/mqtt-log-stdout/pkg/config"
+)
+
+func TestReloadActionFor(t *testing.T) {
+	oldCfg := config.Client{
+		BrokerAddresses: []string{"tcp://localhost:1883"},
+		BrokerPort:      1883,
+		Topic:           "fake-topic",
+		QoS:             0,
+		LogLevel:        "info",
+		KeepAlive:       30 * time.Second,
+		MetricsPort:     8080,
+	}
+
+	cases := []struct {
+		testDescription string
+		modify          func(cfg *config.Client)
+		expectedActions map[string]reloadAction
+	}{
+		{
+			testDescription: "log level is applied directly",
+			modify:          func(cfg *config.Client) { cfg.LogLevel = "debug" },
+			expectedActions: map[string]reloadAction{"LogLevel": actionApply},
+		},
+		{
+			testDescription: "topic filter and qos are resubscribed to",
+			modify: func(cfg *config.Client) {
+				cfg.Topic = "fake-topic-reloaded/#"
+				cfg.QoS = 1
+			},
+			expectedActions: map[string]reloadAction{"Topic": actionResubscribe, "QoS": actionResubscribe},
+		},
+		{
+			testDescription: "connection settings reconnect",
+			modify: func(cfg *config.Client) {
+				cfg.BrokerAddresses = []string{"tcp://localhost:1884"}
+				cfg.BrokerPort = 1884
+				cfg.KeepAlive = time.Minute
+				cfg.Password = "fake-password"
+			},
+			expectedActions: map[string]reloadAction{"BrokerAddresses": actionReconnect, "BrokerPort": actionReconnect, "KeepAlive": actionReconnect, "Password": actionReconnect},
+		},
+		{
+			testDescription: "broker port reconnects without broker addresses changes",
+			modify:          func(cfg *config.Client) { cfg.BrokerPort = 8883 },
+			expectedActions: map[string]reloadAction{"BrokerPort": actionReconnect},
+		},
+		{
+			testDescription: "broker port requires a restart with a broker dns name",
+			modify: func(cfg *config.Client) {
+				cfg.BrokerDNSName = "fake-broker-headless"
+				cfg.BrokerPort = 8883
+			},
+			expectedActions: map[string]reloadAction{"BrokerDNSName": actionRestart, "BrokerPort": actionRestart},
+		},
+		{
+			testDescription: "other settings require a restart",
+			modify: func(cfg *config.Client) {
+				cfg.MetricsPort = 8081
+				cfg.ClientID = "fake-client-id"
+			},
+			expectedActions: map[string]reloadAction{"MetricsPort": actionRestart, "ClientID": actionRestart},
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		newCfg := oldCfg
+		newCfg.BrokerAddresses = append([]string{}, oldCfg.BrokerAddresses...)
+		c.modify(&newCfg)
+
+		actions := map[string]reloadAction{}
+		for _, change := range config.Changes(oldCfg, newCfg) {
+			actions[change] = reloadActionFor(change, newCfg)
+		}
+
+		require.Equal(t, c.expectedActions, actions)
+	}
+}
+
+func TestCopyFields(t *testing.T) {
+	dst := config.Client{Topic: "fake-topic", KeepAlive: time.Minute, Password: "fake-password"}
+	src := config.Client{Topic: "fake-topic-reloaded", KeepAlive: time.Second, Password: "fake-password-reloaded"}
+
+	copyFields(&dst, src, []string{"KeepAlive", "Password"})
+
+	require.Equal(t, config.Client{Topic: "fake-topic", KeepAlive: time.Second, Password: "fake-password-reloaded"}, dst)
+}
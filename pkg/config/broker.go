@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// brokerSchemes are the schemes supported by the MQTT client, tcp is used when the address doesn't have a scheme
+var brokerSchemes = []string{"tcp", "mqtt", "ssl", "tls", "mqtts", "mqtt+ssl", "tcps", "ws", "wss", "unix"}
+
+// getBrokerAddresses returns the broker URLs, port is used for addresses without a port (except websockets and unix sockets)
+func getBrokerAddresses(brokerAddresses []string, port int) ([]string, error) {
+	var newBrokers []string
+	for _, broker := range brokerAddresses {
+		b, err := parseBrokerAddress(broker, port)
+		if err != nil {
+			return nil, err
+		}
+
+		newBrokers = append(newBrokers, b)
+	}
+
+	return newBrokers, nil
+}
+
+// parseBrokerAddress takes a host, host:port, IPv6 address ([fd00::1]:1883 or fd00::1 without a port) or URL with one of brokerSchemes
+func parseBrokerAddress(address string, port int) (string, error) {
+	rawAddress := address
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return "", fmt.Errorf("broker address can't be empty")
+	}
+
+	if !strings.Contains(address, "://") {
+		// A bare IPv6 address can't have a port, since it's not possible to tell them apart
+		if strings.Count(address, ":") > 1 && !strings.HasPrefix(address, "[") {
+			if net.ParseIP(address) == nil {
+				return "", fmt.Errorf("broker address %q isn't a valid IPv6 address, use brackets to add a port: [fd00::1]:1883", rawAddress)
+			}
+
+			address = fmt.Sprintf("[%s]", address)
+		}
+
+		address = fmt.Sprintf("tcp://%s", address)
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", fmt.Errorf("broker address %q is invalid: %w", rawAddress, err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if !isBrokerScheme(u.Scheme) {
+		return "", fmt.Errorf("broker address %q has an unsupported scheme %q, allowed: %s", rawAddress, u.Scheme, strings.Join(brokerSchemes, ", "))
+	}
+
+	if u.Scheme == "unix" {
+		if u.Host == "" && u.Path == "" {
+			return "", fmt.Errorf("broker address %q is missing the socket path", rawAddress)
+		}
+
+		return u.String(), nil
+	}
+
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("broker address %q is missing a host", rawAddress)
+	}
+
+	if strings.Count(u.Host, ":") > 1 && !strings.HasPrefix(u.Host, "[") {
+		return "", fmt.Errorf("broker address %q has an IPv6 address without brackets, use: %s://[%s]", rawAddress, u.Scheme, u.Host)
+	}
+
+	websocket := u.Scheme == "ws" || u.Scheme == "wss"
+	if !websocket && (strings.TrimPrefix(u.Path, "/") != "" || u.RawQuery != "") {
+		return "", fmt.Errorf("broker address %q can only have a path or query with the ws or wss scheme", rawAddress)
+	}
+
+	if !websocket {
+		u.Path = ""
+	}
+
+	if u.Port() != "" {
+		p, err := strconv.Atoi(u.Port())
+		if err != nil || p < 1 || p > 65535 {
+			return "", fmt.Errorf("broker address %q has an invalid port %q, allowed to be between 1 and 65535", rawAddress, u.Port())
+		}
+	}
+
+	if u.Port() == "" && !websocket {
+		if port < 1 || port > 65535 {
+			return "", fmt.Errorf("mqtt port allowed to be between 1 and 65535, received: %d", port)
+		}
+
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+	}
+
+	return u.String(), nil
+}
+
+// validateBrokerDiscovery checks the broker discovery flags, only one of srvRecord and dnsName can be used
+func validateBrokerDiscovery(srvRecord string, dnsName string, scheme string, interval time.Duration, port int) error {
+	if srvRecord != "" && dnsName != "" {
+		return fmt.Errorf("broker SRV record and DNS name can't both be used, received: %q and %q", srvRecord, dnsName)
+	}
+
+	for _, name := range []string{srvRecord, dnsName} {
+		if strings.ContainsAny(name, ":/ ") {
+			return fmt.Errorf("broker discovery name %q isn't a valid DNS name", name)
+		}
+	}
+
+	// Discovered brokers are a host and port, which can't be used with unix sockets
+	if !isBrokerScheme(scheme) || scheme == "unix" {
+		var allowed []string
+		for _, s := range brokerSchemes {
+			if s != "unix" {
+				allowed = append(allowed, s)
+			}
+		}
+
+		return fmt.Errorf("broker discovery scheme %q isn't supported, allowed: %s", scheme, strings.Join(allowed, ", "))
+	}
+
+	if interval < 0 {
+		return fmt.Errorf("broker discovery interval can't be negative, received: %s", interval)
+	}
+
+	if dnsName != "" && (port < 1 || port > 65535) {
+		return fmt.Errorf("mqtt port allowed to be between 1 and 65535, received: %d", port)
+	}
+
+	return nil
+}
+
+func isBrokerScheme(scheme string) bool {
+	for _, s := range brokerSchemes {
+		if s == scheme {
+			return true
+		}
+	}
+
+	return false
+}
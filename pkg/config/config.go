@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/prometheus/common/model"
 	"github.com/urfave/cli/v2"
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+	"github.com/xenitab/mqtt-log-stdout/pkg/status"
 )
 
 var (
@@ -28,24 +33,96 @@ type Options struct {
 
 // Client struct
 type Client struct {
-	BrokerAddresses   []string
-	Topic             string
-	QoS               int
-	KeepAlive         time.Duration
-	ConnectTimeout    time.Duration
-	CleanSession      bool
-	Username          string
-	Password          string
-	ClientID          string
-	MetricsAddress    string
-	MetricsPort       int
-	disableExitOnHelp bool
-	cliReader         io.Reader
-	cliWriter         io.Writer
-	cliErrWriter      io.Writer
-	version           string
-	revision          string
-	created           string
+	BrokerAddresses              []string
+	BrokerSRVRecord              string
+	BrokerDNSName                string
+	BrokerPort                   int
+	BrokerDiscoveryScheme        string
+	BrokerDiscoveryInterval      time.Duration
+	Topic                        string
+	QoS                          int
+	KeepAlive                    time.Duration
+	ConnectTimeout               time.Duration
+	ConnectRetry                 bool
+	ConnectRetryDeadline         time.Duration
+	ReconnectInitialInterval     time.Duration
+	ReconnectMaxInterval         time.Duration
+	ReconnectJitter              float64
+	ReconnectMaxAttempts         int
+	CleanSession                 bool
+	SessionStoreDirectory        string
+	Username                     string
+	Password                     string
+	UsernameFile                 string
+	PasswordFile                 string
+	OAuth2TokenURL               string
+	OAuth2ClientID               string
+	OAuth2ClientSecret           string
+	OAuth2ClientSecretFile       string
+	OAuth2Scopes                 []string
+	OAuth2Audience               string
+	OAuth2RefreshBefore          time.Duration
+	TLSCAFile                    string
+	TLSCertFile                  string
+	TLSKeyFile                   string
+	TLSALPNProtocols             []string
+	TLSInsecureSkipVerify        bool
+	Profile                      string
+	ProfileHost                  string
+	AzureSharedAccessKey         string
+	AzureSharedAccessKeyFile     string
+	AzureSharedAccessKeyName     string
+	AzureSASTokenTTL             time.Duration
+	WillTopic                    string
+	WillPayload                  string
+	WillQoS                      int
+	WillRetained                 bool
+	PresenceMessages             bool
+	RetainedMessages             string
+	MessageEnvelope              bool
+	ClientID                     string
+	MetricsAddress               string
+	MetricsPort                  int
+	MetricsNamespace             string
+	MetricsConstLabels           map[string]string
+	MetricsTLSCertFile           string
+	MetricsTLSKeyFile            string
+	MetricsTLSClientCAFile       string
+	MetricsBasicAuthUsername     string
+	MetricsBasicAuthPassword     string
+	MetricsBearerToken           string
+	MetricsBasicAuthPasswordFile string
+	MetricsBearerTokenFile       string
+	MetricsReadTimeout           time.Duration
+	MetricsWriteTimeout          time.Duration
+	MetricsIdleTimeout           time.Duration
+	MetricsLivenessThreshold     time.Duration
+	AdminAPI                     bool
+	TailEndpoint                 bool
+	TailBufferSize               int
+	TailMaxClients               int
+	LogLevel                     string
+	LogFormat                    string
+	StatusOutput                 string
+	StatusOutputFile             string
+	StatusTag                    bool
+	MetricsTopicDepth            int
+	MetricsTopicMaxLabels        int
+	LatencyTimestampField        string
+	StalenessThreshold           time.Duration
+	DebugEndpoints               bool
+	DebugAddress                 string
+	DebugPort                    int
+	ConfigFile                   string
+	ConfigWatchInterval          time.Duration
+	args                         []string
+	disableExitOnHelp            bool
+	cliReader                    io.Reader
+	cliWriter                    io.Writer
+	cliErrWriter                 io.Writer
+	version                      string
+	revision                     string
+	created                      string
 }
 
 // NewClient returns the Client or error
@@ -79,6 +156,7 @@ func newClient(opts Options) *Client {
 }
 
 func (client *Client) generateConfig(args []string) (Client, error) {
+	client.args = args
 	app := client.newCLIApp()
 
 	err := app.Run(args)
@@ -97,22 +175,95 @@ func (client *Client) generateMarkdown(filePath string) error {
 		return err
 	}
 
+	md += configFileMarkdown(app.Flags)
+
 	err = os.WriteFile(filePath, []byte(md), 0666) // #nosec
 	return err
 }
 
 func (client *Client) setConfig(cfg Client) {
 	client.BrokerAddresses = cfg.BrokerAddresses
+	client.BrokerSRVRecord = cfg.BrokerSRVRecord
+	client.BrokerDNSName = cfg.BrokerDNSName
+	client.BrokerPort = cfg.BrokerPort
+	client.BrokerDiscoveryScheme = cfg.BrokerDiscoveryScheme
+	client.BrokerDiscoveryInterval = cfg.BrokerDiscoveryInterval
 	client.Topic = cfg.Topic
 	client.QoS = cfg.QoS
 	client.KeepAlive = cfg.KeepAlive
 	client.ConnectTimeout = cfg.ConnectTimeout
+	client.ConnectRetry = cfg.ConnectRetry
+	client.ConnectRetryDeadline = cfg.ConnectRetryDeadline
+	client.ReconnectInitialInterval = cfg.ReconnectInitialInterval
+	client.ReconnectMaxInterval = cfg.ReconnectMaxInterval
+	client.ReconnectJitter = cfg.ReconnectJitter
+	client.ReconnectMaxAttempts = cfg.ReconnectMaxAttempts
 	client.CleanSession = cfg.CleanSession
+	client.SessionStoreDirectory = cfg.SessionStoreDirectory
 	client.Username = cfg.Username
 	client.Password = cfg.Password
+	client.UsernameFile = cfg.UsernameFile
+	client.PasswordFile = cfg.PasswordFile
+	client.OAuth2TokenURL = cfg.OAuth2TokenURL
+	client.OAuth2ClientID = cfg.OAuth2ClientID
+	client.OAuth2ClientSecret = cfg.OAuth2ClientSecret
+	client.OAuth2ClientSecretFile = cfg.OAuth2ClientSecretFile
+	client.OAuth2Scopes = cfg.OAuth2Scopes
+	client.OAuth2Audience = cfg.OAuth2Audience
+	client.OAuth2RefreshBefore = cfg.OAuth2RefreshBefore
+	client.TLSCAFile = cfg.TLSCAFile
+	client.TLSCertFile = cfg.TLSCertFile
+	client.TLSKeyFile = cfg.TLSKeyFile
+	client.TLSALPNProtocols = cfg.TLSALPNProtocols
+	client.TLSInsecureSkipVerify = cfg.TLSInsecureSkipVerify
+	client.Profile = cfg.Profile
+	client.ProfileHost = cfg.ProfileHost
+	client.AzureSharedAccessKey = cfg.AzureSharedAccessKey
+	client.AzureSharedAccessKeyFile = cfg.AzureSharedAccessKeyFile
+	client.AzureSharedAccessKeyName = cfg.AzureSharedAccessKeyName
+	client.AzureSASTokenTTL = cfg.AzureSASTokenTTL
+	client.WillTopic = cfg.WillTopic
+	client.WillPayload = cfg.WillPayload
+	client.WillQoS = cfg.WillQoS
+	client.WillRetained = cfg.WillRetained
+	client.PresenceMessages = cfg.PresenceMessages
+	client.RetainedMessages = cfg.RetainedMessages
+	client.MessageEnvelope = cfg.MessageEnvelope
 	client.ClientID = cfg.ClientID
 	client.MetricsAddress = cfg.MetricsAddress
 	client.MetricsPort = cfg.MetricsPort
+	client.MetricsNamespace = cfg.MetricsNamespace
+	client.MetricsConstLabels = cfg.MetricsConstLabels
+	client.MetricsTLSCertFile = cfg.MetricsTLSCertFile
+	client.MetricsTLSKeyFile = cfg.MetricsTLSKeyFile
+	client.MetricsTLSClientCAFile = cfg.MetricsTLSClientCAFile
+	client.MetricsBasicAuthUsername = cfg.MetricsBasicAuthUsername
+	client.MetricsBasicAuthPassword = cfg.MetricsBasicAuthPassword
+	client.MetricsBearerToken = cfg.MetricsBearerToken
+	client.MetricsBasicAuthPasswordFile = cfg.MetricsBasicAuthPasswordFile
+	client.MetricsBearerTokenFile = cfg.MetricsBearerTokenFile
+	client.MetricsReadTimeout = cfg.MetricsReadTimeout
+	client.MetricsWriteTimeout = cfg.MetricsWriteTimeout
+	client.MetricsIdleTimeout = cfg.MetricsIdleTimeout
+	client.MetricsLivenessThreshold = cfg.MetricsLivenessThreshold
+	client.AdminAPI = cfg.AdminAPI
+	client.TailEndpoint = cfg.TailEndpoint
+	client.TailBufferSize = cfg.TailBufferSize
+	client.TailMaxClients = cfg.TailMaxClients
+	client.LogLevel = cfg.LogLevel
+	client.LogFormat = cfg.LogFormat
+	client.StatusOutput = cfg.StatusOutput
+	client.StatusOutputFile = cfg.StatusOutputFile
+	client.StatusTag = cfg.StatusTag
+	client.MetricsTopicDepth = cfg.MetricsTopicDepth
+	client.MetricsTopicMaxLabels = cfg.MetricsTopicMaxLabels
+	client.LatencyTimestampField = cfg.LatencyTimestampField
+	client.StalenessThreshold = cfg.StalenessThreshold
+	client.DebugEndpoints = cfg.DebugEndpoints
+	client.DebugAddress = cfg.DebugAddress
+	client.DebugPort = cfg.DebugPort
+	client.ConfigFile = cfg.ConfigFile
+	client.ConfigWatchInterval = cfg.ConfigWatchInterval
 }
 
 func (client *Client) setIO(reader io.Reader, writer io.Writer, errWriter io.Writer) {
@@ -146,29 +297,69 @@ func (client *Client) newCLIAction(c *cli.Context) error {
 }
 
 func (client *Client) newCLIFlags() []cli.Flag {
+	// mqtt-broker-addresses and mqtt-topic are required, but validated by setConfigFromCLI since they can be set in the config file
 	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     configFileFlag,
+			Usage:    "The YAML (.yaml or .yml) or TOML (.toml) config file, flags and env vars take precedence over it",
+			Required: false,
+			EnvVars:  []string{"CONFIG_FILE"},
+		},
+		&cli.IntFlag{
+			Name:     "config-watch-interval",
+			Usage:    "How often should the config file be checked for changes, reloading the config when changed? (in seconds, 0 = disabled, the config is also reloaded on SIGHUP)",
+			Required: false,
+			EnvVars:  []string{"CONFIG_WATCH_INTERVAL"},
+			Value:    0,
+		},
 		&cli.StringSliceFlag{
 			Name:     "mqtt-broker-addresses",
-			Usage:    "The MQTT broker addresses",
-			Required: true,
+			Usage:    "The MQTT broker addresses: host, host:port, IPv6 address ([fd00::1]:1883 or fd00::1) or URL (like ssl://host:8883 or wss://host/mqtt)",
+			Required: false,
 			EnvVars:  []string{"MQTT_BROKER_ADDRESSES", "MQTT_HOST_1", "MQTT_HOST_2", "MQTT_HOST_3"},
 		},
 		&cli.StringFlag{
 			Name:     "mqtt-topic",
 			Usage:    "The MQTT topic to output logs for",
-			Required: true,
+			Required: false,
 			EnvVars:  []string{"MQTT_TOPIC", "LOG_TOPIC"},
 		},
 		&cli.IntFlag{
 			Name:     "mqtt-port",
-			Usage:    "The MQTT port",
+			Usage:    "The MQTT port used for broker addresses without a port (except ws, wss and unix)",
 			Required: false,
 			EnvVars:  []string{"MQTT_PORT"},
 			Value:    1883,
 		},
+		&cli.StringFlag{
+			Name:     "mqtt-broker-srv-record",
+			Usage:    "DNS SRV record to discover the MQTT brokers from (like _mqtt._tcp.example.com), used before the broker addresses",
+			Required: false,
+			EnvVars:  []string{"MQTT_BROKER_SRV_RECORD"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-broker-dns-name",
+			Usage:    "DNS name to discover the MQTT brokers from using all its A and AAAA records (like a Kubernetes headless service) and the MQTT port, used before the broker addresses",
+			Required: false,
+			EnvVars:  []string{"MQTT_BROKER_DNS_NAME"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-broker-discovery-scheme",
+			Usage:    "The scheme used for the discovered MQTT brokers (like tcp, ssl or ws)",
+			Required: false,
+			EnvVars:  []string{"MQTT_BROKER_DISCOVERY_SCHEME"},
+			Value:    "tcp",
+		},
+		&cli.IntFlag{
+			Name:     "mqtt-broker-discovery-interval",
+			Usage:    "How often the MQTT brokers are discovered in seconds, they are also discovered before every (re)connect (0 = only before connecting)",
+			Required: false,
+			EnvVars:  []string{"MQTT_BROKER_DISCOVERY_INTERVAL"},
+			Value:    30,
+		},
 		&cli.IntFlag{
 			Name:     "mqtt-qos",
-			Usage:    "The MQTT QoS",
+			Usage:    "The MQTT QoS (0, 1 or 2)",
 			Required: false,
 			EnvVars:  []string{"MQTT_QOS"},
 			Value:    0,
@@ -187,6 +378,48 @@ func (client *Client) newCLIFlags() []cli.Flag {
 			EnvVars:  []string{"MQTT_CONNECT_TIMEOUT"},
 			Value:    1,
 		},
+		&cli.BoolFlag{
+			Name:     "mqtt-connect-retry",
+			Usage:    "Should the MQTT client retry the initial connection (using the reconnect backoff) instead of exiting on the first failure?",
+			Required: false,
+			EnvVars:  []string{"MQTT_CONNECT_RETRY"},
+			Value:    false,
+		},
+		&cli.IntFlag{
+			Name:     "mqtt-connect-retry-deadline",
+			Usage:    "How long should the MQTT client retry the initial connection before exiting? (in seconds, 0 = no deadline)",
+			Required: false,
+			EnvVars:  []string{"MQTT_CONNECT_RETRY_DEADLINE"},
+			Value:    300,
+		},
+		&cli.IntFlag{
+			Name:     "mqtt-reconnect-initial-interval",
+			Usage:    "How long should the MQTT client wait before the first reconnect attempt? Doubled for every attempt (in seconds, at least 1)",
+			Required: false,
+			EnvVars:  []string{"MQTT_RECONNECT_INITIAL_INTERVAL"},
+			Value:    1,
+		},
+		&cli.IntFlag{
+			Name:     "mqtt-reconnect-max-interval",
+			Usage:    "The maximum time the MQTT client should wait between reconnect attempts (in seconds)",
+			Required: false,
+			EnvVars:  []string{"MQTT_RECONNECT_MAX_INTERVAL"},
+			Value:    600,
+		},
+		&cli.Float64Flag{
+			Name:     "mqtt-reconnect-jitter",
+			Usage:    "The fraction (0-1) of the reconnect interval that should be randomized",
+			Required: false,
+			EnvVars:  []string{"MQTT_RECONNECT_JITTER"},
+			Value:    0.2,
+		},
+		&cli.IntFlag{
+			Name:     "mqtt-reconnect-max-attempts",
+			Usage:    "How many times should the MQTT client try to reconnect before giving up and exiting? (0 = unlimited)",
+			Required: false,
+			EnvVars:  []string{"MQTT_RECONNECT_MAX_ATTEMPTS"},
+			Value:    0,
+		},
 		&cli.BoolFlag{
 			Name:     "mqtt-clean-session",
 			Usage:    "Should the MQTT client initiate a clean session when subscribing to the topic?",
@@ -194,6 +427,12 @@ func (client *Client) newCLIFlags() []cli.Flag {
 			EnvVars:  []string{"MQTT_CLEAN_SESSION"},
 			Value:    false,
 		},
+		&cli.StringFlag{
+			Name:     "mqtt-session-store-directory",
+			Usage:    "Directory where the MQTT session (in-flight messages) should be persisted, for example a volume mount (in-memory if empty). Requires mqtt-client-id to be set",
+			Required: false,
+			EnvVars:  []string{"MQTT_SESSION_STORE_DIRECTORY"},
+		},
 		&cli.StringFlag{
 			Name:     "mqtt-username",
 			Usage:    "The MQTT username",
@@ -206,6 +445,176 @@ func (client *Client) newCLIFlags() []cli.Flag {
 			Required: false,
 			EnvVars:  []string{"MQTT_PASSWORD"},
 		},
+		&cli.StringFlag{
+			Name:     "mqtt-username-file",
+			Usage:    "File with the MQTT username, read again on every reconnect (can't be combined with mqtt-username)",
+			Required: false,
+			EnvVars:  []string{"MQTT_USERNAME_FILE"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-password-file",
+			Usage:    "File with the MQTT password, read again on every reconnect (can't be combined with mqtt-password)",
+			Required: false,
+			EnvVars:  []string{"MQTT_PASSWORD_FILE"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-oauth2-token-url",
+			Usage:    "Token endpoint used to request an OAuth2 client credentials token, which is used as the MQTT password (can't be combined with mqtt-password)",
+			Required: false,
+			EnvVars:  []string{"MQTT_OAUTH2_TOKEN_URL"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-oauth2-client-id",
+			Usage:    "The OAuth2 client ID, also used as the MQTT username if mqtt-username isn't set",
+			Required: false,
+			EnvVars:  []string{"MQTT_OAUTH2_CLIENT_ID"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-oauth2-client-secret",
+			Usage:    "The OAuth2 client secret",
+			Required: false,
+			EnvVars:  []string{"MQTT_OAUTH2_CLIENT_SECRET"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-oauth2-client-secret-file",
+			Usage:    "File with the OAuth2 client secret, read again on every token request (can't be combined with mqtt-oauth2-client-secret)",
+			Required: false,
+			EnvVars:  []string{"MQTT_OAUTH2_CLIENT_SECRET_FILE"},
+		},
+		&cli.StringSliceFlag{
+			Name:     "mqtt-oauth2-scopes",
+			Usage:    "The OAuth2 scopes to request",
+			Required: false,
+			EnvVars:  []string{"MQTT_OAUTH2_SCOPES"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-oauth2-audience",
+			Usage:    "The OAuth2 audience to request, required by some servers to issue a JWT",
+			Required: false,
+			EnvVars:  []string{"MQTT_OAUTH2_AUDIENCE"},
+		},
+		&cli.IntFlag{
+			Name:     "mqtt-oauth2-refresh-before",
+			Usage:    "How long before the expiry a new OAuth2 token is requested in seconds, the token is only requested when (re)connecting",
+			Required: false,
+			EnvVars:  []string{"MQTT_OAUTH2_REFRESH_BEFORE"},
+			Value:    60,
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-tls-ca-file",
+			Usage:    "CA file used to verify the MQTT broker instead of the system CAs",
+			Required: false,
+			EnvVars:  []string{"MQTT_TLS_CA_FILE"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-tls-cert-file",
+			Usage:    "Client certificate file to authenticate to the MQTT broker, read again on every reconnect",
+			Required: false,
+			EnvVars:  []string{"MQTT_TLS_CERT_FILE"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-tls-key-file",
+			Usage:    "Client key file to authenticate to the MQTT broker, read again on every reconnect",
+			Required: false,
+			EnvVars:  []string{"MQTT_TLS_KEY_FILE"},
+		},
+		&cli.StringSliceFlag{
+			Name:     "mqtt-tls-alpn",
+			Usage:    "ALPN protocols sent to the MQTT broker in the TLS handshake",
+			Required: false,
+			EnvVars:  []string{"MQTT_TLS_ALPN"},
+		},
+		&cli.BoolFlag{
+			Name:     "mqtt-tls-insecure-skip-verify",
+			Usage:    "Don't verify the MQTT broker certificate (insecure, only for testing)",
+			Required: false,
+			EnvVars:  []string{"MQTT_TLS_INSECURE_SKIP_VERIFY"},
+			Value:    false,
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-profile",
+			Usage:    "Connection profile filling in the broker, username, password and TLS settings from the profile host: azure-iot-hub (SAS token, the client ID is the device ID), azure-event-grid (client certificate) or aws-iot-core (client certificate on port 443)",
+			Required: false,
+			EnvVars:  []string{"MQTT_PROFILE"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-profile-host",
+			Usage:    "The host name used by the connection profile, like example.azure-devices.net, example.westeurope-1.ts.eventgrid.azure.net or example-ats.iot.eu-west-1.amazonaws.com",
+			Required: false,
+			EnvVars:  []string{"MQTT_PROFILE_HOST"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-azure-shared-access-key",
+			Usage:    "The Azure IoT Hub shared access key (base64) used to generate SAS tokens",
+			Required: false,
+			EnvVars:  []string{"MQTT_AZURE_SHARED_ACCESS_KEY"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-azure-shared-access-key-file",
+			Usage:    "File with the Azure IoT Hub shared access key, read again on every reconnect (can't be combined with mqtt-azure-shared-access-key)",
+			Required: false,
+			EnvVars:  []string{"MQTT_AZURE_SHARED_ACCESS_KEY_FILE"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-azure-shared-access-key-name",
+			Usage:    "The Azure IoT Hub shared access policy name, empty when using a device key",
+			Required: false,
+			EnvVars:  []string{"MQTT_AZURE_SHARED_ACCESS_KEY_NAME"},
+		},
+		&cli.IntFlag{
+			Name:     "mqtt-azure-sas-token-ttl",
+			Usage:    "How long the Azure IoT Hub SAS token is valid in seconds, a new token is generated on every reconnect",
+			Required: false,
+			EnvVars:  []string{"MQTT_AZURE_SAS_TOKEN_TTL"},
+			Value:    3600,
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-will-topic",
+			Usage:    "Topic for the last will and the presence messages, {client_id} is replaced with the MQTT client ID (disabled if empty)",
+			Required: false,
+			EnvVars:  []string{"MQTT_WILL_TOPIC"},
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-will-payload",
+			Usage:    "The last will payload, a JSON message with the client ID and the offline status is used if empty",
+			Required: false,
+			EnvVars:  []string{"MQTT_WILL_PAYLOAD"},
+		},
+		&cli.IntFlag{
+			Name:     "mqtt-will-qos",
+			Usage:    "The QoS (0, 1 or 2) of the last will and the presence messages",
+			Required: false,
+			EnvVars:  []string{"MQTT_WILL_QOS"},
+			Value:    1,
+		},
+		&cli.BoolFlag{
+			Name:     "mqtt-will-retained",
+			Usage:    "Retain the last will and the presence messages, to show the current state to new subscribers",
+			Required: false,
+			EnvVars:  []string{"MQTT_WILL_RETAINED"},
+			Value:    true,
+		},
+		&cli.BoolFlag{
+			Name:     "mqtt-presence-messages",
+			Usage:    "Publish an online (birth) message with the client ID, version and subscribed topics after connecting and an offline message when stopping to the will topic",
+			Required: false,
+			EnvVars:  []string{"MQTT_PRESENCE_MESSAGES"},
+			Value:    true,
+		},
+		&cli.StringFlag{
+			Name:     "mqtt-retained-messages",
+			Usage:    "How retained messages (re-delivered by the broker when subscribing) are handled: print, skip or first-connect (only printed the first time a subscription is subscribed to, not after reconnecting)",
+			Required: false,
+			EnvVars:  []string{"MQTT_RETAINED_MESSAGES"},
+			Value:    "print",
+		},
+		&cli.BoolFlag{
+			Name:     "message-envelope",
+			Usage:    "Print the messages in a JSON envelope with the topic, retained flag, received timestamp and payload",
+			Required: false,
+			EnvVars:  []string{"MESSAGE_ENVELOPE"},
+			Value:    false,
+		},
 		&cli.StringFlag{
 			Name:     "mqtt-client-id",
 			Usage:    "The MQTT Client ID (defaults to host name)",
@@ -233,10 +642,234 @@ func (client *Client) newCLIFlags() []cli.Flag {
 			EnvVars:  []string{"METRICS_PORT"},
 			Value:    8080,
 		},
+		&cli.StringFlag{
+			Name:     "metrics-namespace",
+			Usage:    "The namespace (prefix) for the application metrics",
+			Required: false,
+			EnvVars:  []string{"METRICS_NAMESPACE"},
+		},
+		&cli.StringSliceFlag{
+			Name:     "metrics-const-labels",
+			Usage:    "Labels added to all metrics (format: key=value)",
+			Required: false,
+			EnvVars:  []string{"METRICS_CONST_LABELS"},
+		},
+		&cli.StringFlag{
+			Name:     "metrics-tls-cert-file",
+			Usage:    "The certificate file to serve metrics with TLS, reloaded when changed",
+			Required: false,
+			EnvVars:  []string{"METRICS_TLS_CERT_FILE"},
+		},
+		&cli.StringFlag{
+			Name:     "metrics-tls-key-file",
+			Usage:    "The key file to serve metrics with TLS, reloaded when changed",
+			Required: false,
+			EnvVars:  []string{"METRICS_TLS_KEY_FILE"},
+		},
+		&cli.StringFlag{
+			Name:     "metrics-tls-client-ca-file",
+			Usage:    "The CA file used to verify client certificates, required for all endpoints except /healthz and /readyz when set",
+			Required: false,
+			EnvVars:  []string{"METRICS_TLS_CLIENT_CA_FILE"},
+		},
+		&cli.StringFlag{
+			Name:     "metrics-basic-auth-username",
+			Usage:    "The basic auth username required for all endpoints except /healthz and /readyz",
+			Required: false,
+			EnvVars:  []string{"METRICS_BASIC_AUTH_USERNAME"},
+		},
+		&cli.StringFlag{
+			Name:     "metrics-basic-auth-password",
+			Usage:    "The basic auth password required for all endpoints except /healthz and /readyz",
+			Required: false,
+			EnvVars:  []string{"METRICS_BASIC_AUTH_PASSWORD"},
+		},
+		&cli.StringFlag{
+			Name:     "metrics-basic-auth-password-file",
+			Usage:    "File with the basic auth password, read again when changed (can't be combined with metrics-basic-auth-password)",
+			Required: false,
+			EnvVars:  []string{"METRICS_BASIC_AUTH_PASSWORD_FILE"},
+		},
+		&cli.StringFlag{
+			Name:     "metrics-bearer-token",
+			Usage:    "The bearer token required for all endpoints except /healthz and /readyz",
+			Required: false,
+			EnvVars:  []string{"METRICS_BEARER_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:     "metrics-bearer-token-file",
+			Usage:    "File with the bearer token, read again when changed (can't be combined with metrics-bearer-token)",
+			Required: false,
+			EnvVars:  []string{"METRICS_BEARER_TOKEN_FILE"},
+		},
+		&cli.IntFlag{
+			Name:     "metrics-read-timeout",
+			Usage:    "The max duration for the metrics server to read a request (in seconds, 0 = no timeout)",
+			Required: false,
+			EnvVars:  []string{"METRICS_READ_TIMEOUT"},
+			Value:    30,
+		},
+		&cli.IntFlag{
+			Name:     "metrics-write-timeout",
+			Usage:    "The max duration for the metrics server to write a response (in seconds, 0 = no timeout)",
+			Required: false,
+			EnvVars:  []string{"METRICS_WRITE_TIMEOUT"},
+			Value:    60,
+		},
+		&cli.IntFlag{
+			Name:     "metrics-idle-timeout",
+			Usage:    "The max duration for the metrics server to keep idle connections open (in seconds, 0 = no timeout)",
+			Required: false,
+			EnvVars:  []string{"METRICS_IDLE_TIMEOUT"},
+			Value:    120,
+		},
+		&cli.IntFlag{
+			Name:     "metrics-liveness-threshold",
+			Usage:    "How long a component (like the mqtt connection) can be unhealthy before /healthz fails and the pod is restarted (in seconds, 0 = /healthz always succeeds)",
+			Required: false,
+			EnvVars:  []string{"METRICS_LIVENESS_THRESHOLD"},
+			Value:    300,
+		},
+		&cli.BoolFlag{
+			Name:     "admin-api",
+			Usage:    "Should the admin API (/admin/*) to manage subscriptions and pause/resume printing be exposed on the metrics server? Requires authentication to be configured",
+			Required: false,
+			EnvVars:  []string{"ADMIN_API"},
+			Value:    false,
+		},
+		&cli.BoolFlag{
+			Name:     "tail-endpoint",
+			Usage:    "Should /tail, streaming received messages (Server-Sent Events or WebSocket), be exposed on the metrics server? Requires authentication to be configured",
+			Required: false,
+			EnvVars:  []string{"TAIL_ENDPOINT"},
+			Value:    false,
+		},
+		&cli.IntFlag{
+			Name:     "tail-buffer-size",
+			Usage:    "The number of messages buffered per tail client, slow clients are disconnected when it is full",
+			Required: false,
+			EnvVars:  []string{"TAIL_BUFFER_SIZE"},
+			Value:    100,
+		},
+		&cli.IntFlag{
+			Name:     "tail-max-clients",
+			Usage:    "The max number of concurrent tail clients",
+			Required: false,
+			EnvVars:  []string{"TAIL_MAX_CLIENTS"},
+			Value:    10,
+		},
+		&cli.StringFlag{
+			Name:     "log-level",
+			Usage:    "The minimum level of status messages printed (debug, info, warn or error)",
+			Required: false,
+			EnvVars:  []string{"LOG_LEVEL"},
+			Value:    "info",
+		},
+		&cli.StringFlag{
+			Name:     "log-format",
+			Usage:    "The format of status messages (json or text)",
+			Required: false,
+			EnvVars:  []string{"LOG_FORMAT"},
+			Value:    "json",
+		},
+		&cli.StringFlag{
+			Name:     "status-output",
+			Usage:    "Where status messages are written (split = warnings and errors to stderr and the rest to stdout, stdout, stderr, file or disabled)",
+			Required: false,
+			EnvVars:  []string{"STATUS_OUTPUT"},
+			Value:    status.OutputSplit,
+		},
+		&cli.StringFlag{
+			Name:     "status-output-file",
+			Usage:    "The file status messages are appended to when status-output is file",
+			Required: false,
+			EnvVars:  []string{"STATUS_OUTPUT_FILE"},
+		},
+		&cli.BoolFlag{
+			Name:     "status-tag",
+			Usage:    fmt.Sprintf("Should status messages be tagged with the field %q to tell them apart from device messages?", status.TagKey),
+			Required: false,
+			EnvVars:  []string{"STATUS_TAG"},
+			Value:    false,
+		},
+		&cli.IntFlag{
+			Name:     "metrics-topic-depth",
+			Usage:    "The number of topic levels used as label for the per topic metrics (0 = the full topic)",
+			Required: false,
+			EnvVars:  []string{"METRICS_TOPIC_DEPTH"},
+			Value:    0,
+		},
+		&cli.IntFlag{
+			Name:     "metrics-topic-max-labels",
+			Usage:    "The max number of topic labels for the per topic metrics, additional topics are reported as \"__other__\"",
+			Required: false,
+			EnvVars:  []string{"METRICS_TOPIC_MAX_LABELS"},
+			Value:    100,
+		},
+		&cli.StringFlag{
+			Name:     "metrics-latency-timestamp-field",
+			Usage:    "The JSON field (nested using dots) in the message payload with the publish timestamp (RFC3339 or unix seconds/milliseconds), enables the latency metric",
+			Required: false,
+			EnvVars:  []string{"METRICS_LATENCY_TIMESTAMP_FIELD"},
+		},
+		&cli.IntFlag{
+			Name:     "mqtt-staleness-threshold",
+			Usage:    "How long can a subscription be silent before a warning is printed? (in seconds, 0 = disabled)",
+			Required: false,
+			EnvVars:  []string{"MQTT_STALENESS_THRESHOLD"},
+			Value:    0,
+		},
+		&cli.BoolFlag{
+			Name:     "debug-endpoints",
+			Usage:    "Should pprof and /debug/state be exposed on debug-address and debug-port?",
+			Required: false,
+			EnvVars:  []string{"DEBUG_ENDPOINTS"},
+			Value:    false,
+		},
+		&cli.StringFlag{
+			Name:     "debug-address",
+			Usage:    "The http address the debug endpoints should be exposed on",
+			Required: false,
+			EnvVars:  []string{"DEBUG_ADDRESS"},
+			Value:    "127.0.0.1",
+		},
+		&cli.IntFlag{
+			Name:     "debug-port",
+			Usage:    "The http port the debug endpoints should be exposed on",
+			Required: false,
+			EnvVars:  []string{"DEBUG_PORT"},
+			Value:    6060,
+		},
 	}
 }
 
 func (client *Client) setConfigFromCLI(cli *cli.Context) error {
+	configFilePath := cli.String(configFileFlag)
+	file, err := applyConfigFile(cli, cli.App.Flags, configFilePath)
+	if err != nil {
+		return err
+	}
+
+	requiredFlags := []string{"mqtt-topic"}
+	// The broker addresses are optional when the brokers are discovered or filled in by a profile
+	if cli.String("mqtt-broker-srv-record") == "" && cli.String("mqtt-broker-dns-name") == "" && cli.String("mqtt-profile") == "" {
+		requiredFlags = []string{"mqtt-broker-addresses", "mqtt-topic"}
+	}
+
+	err = validateRequiredFlags(cli, requiredFlags...)
+	if err != nil {
+		return err
+	}
+
+	configWatchInterval := time.Duration(cli.Int("config-watch-interval")) * time.Second
+	if configWatchInterval < 0 {
+		return file.wrapErr(fmt.Errorf("config watch interval can't be negative, received: %s", configWatchInterval), "config-watch-interval")
+	}
+
+	if configWatchInterval > 0 && configFilePath == "" {
+		return file.wrapErr(fmt.Errorf("config watch interval requires a config file"), "config-watch-interval")
+	}
+
 	flagMqttClientID := cli.String("mqtt-client-id")
 	flagMqttClientIDRandomSuffix := cli.Bool("mqtt-client-id-random-suffix")
 	mqttClientID, err := getClientID(flagMqttClientID, flagMqttClientIDRandomSuffix)
@@ -246,29 +879,283 @@ func (client *Client) setConfigFromCLI(cli *cli.Context) error {
 
 	flagMqttBrokerAddresses := cli.StringSlice("mqtt-broker-addresses")
 	flagMqttPort := cli.Int("mqtt-port")
-	brokerAddresses := getBrokerAddresses(flagMqttBrokerAddresses, flagMqttPort)
+	brokerAddresses, err := getBrokerAddresses(flagMqttBrokerAddresses, flagMqttPort)
+	if err != nil {
+		return file.wrapErr(err, "mqtt-broker-addresses", "mqtt-port")
+	}
+
+	brokerSRVRecord := cli.String("mqtt-broker-srv-record")
+	brokerDNSName := cli.String("mqtt-broker-dns-name")
+	brokerDiscoveryScheme := strings.ToLower(cli.String("mqtt-broker-discovery-scheme"))
+	brokerDiscoveryInterval := time.Duration(cli.Int("mqtt-broker-discovery-interval")) * time.Second
+	err = validateBrokerDiscovery(brokerSRVRecord, brokerDNSName, brokerDiscoveryScheme, brokerDiscoveryInterval, flagMqttPort)
+	if err != nil {
+		return file.wrapErr(err, "mqtt-broker-srv-record", "mqtt-broker-dns-name", "mqtt-broker-discovery-scheme", "mqtt-broker-discovery-interval", "mqtt-port")
+	}
 
 	flagQoS := cli.Int("mqtt-qos")
 	qos, err := getQoS(flagQoS)
 	if err != nil {
-		return err
+		return file.wrapErr(err, "mqtt-qos")
+	}
+
+	// The session store sub directory is named after the client ID, which needs to be the same after a restart to recover the session
+	if cli.String("mqtt-session-store-directory") != "" && (flagMqttClientID == "" || flagMqttClientIDRandomSuffix) {
+		return file.wrapErr(fmt.Errorf("mqtt session store directory requires a fixed mqtt client ID (without random suffix)"), "mqtt-session-store-directory", "mqtt-client-id", "mqtt-client-id-random-suffix")
+	}
+
+	sessionStoreDirectory, err := getSessionStoreDirectory(cli.String("mqtt-session-store-directory"))
+	if err != nil {
+		return file.wrapErr(err, "mqtt-session-store-directory")
+	}
+
+	err = validateSecretFile("mqtt username", cli.String("mqtt-username"), cli.String("mqtt-username-file"))
+	if err != nil {
+		return file.wrapErr(err, "mqtt-username", "mqtt-username-file")
+	}
+
+	err = validateSecretFile("mqtt password", cli.String("mqtt-password"), cli.String("mqtt-password-file"))
+	if err != nil {
+		return file.wrapErr(err, "mqtt-password", "mqtt-password-file")
+	}
+
+	oauth2TokenURL := cli.String("mqtt-oauth2-token-url")
+	oauth2RefreshBefore := time.Duration(cli.Int("mqtt-oauth2-refresh-before")) * time.Second
+	err = validateOAuth2(oauth2TokenURL, cli.String("mqtt-oauth2-client-id"), cli.String("mqtt-oauth2-client-secret"), cli.String("mqtt-oauth2-client-secret-file"), oauth2RefreshBefore)
+	if err != nil {
+		return file.wrapErr(err, "mqtt-oauth2-token-url", "mqtt-oauth2-client-id", "mqtt-oauth2-client-secret", "mqtt-oauth2-client-secret-file", "mqtt-oauth2-refresh-before")
+	}
+
+	err = validateMqttTLS(cli.String("mqtt-tls-ca-file"), cli.String("mqtt-tls-cert-file"), cli.String("mqtt-tls-key-file"))
+	if err != nil {
+		return file.wrapErr(err, "mqtt-tls-ca-file", "mqtt-tls-cert-file", "mqtt-tls-key-file")
+	}
+
+	err = validateSecretFile("Azure shared access key", cli.String("mqtt-azure-shared-access-key"), cli.String("mqtt-azure-shared-access-key-file"))
+	if err != nil {
+		return file.wrapErr(err, "mqtt-azure-shared-access-key", "mqtt-azure-shared-access-key-file")
+	}
+
+	willQoS, err := getQoS(cli.Int("mqtt-will-qos"))
+	if err != nil {
+		return file.wrapErr(fmt.Errorf("will %w", err), "mqtt-will-qos")
+	}
+
+	retainedMessages := strings.ToLower(cli.String("mqtt-retained-messages"))
+	if retainedMessages != "print" && retainedMessages != "skip" && retainedMessages != "first-connect" {
+		return file.wrapErr(fmt.Errorf("mqtt retained messages allowed to be print, skip or first-connect, received: %s", retainedMessages), "mqtt-retained-messages")
+	}
+
+	willTopic := strings.ReplaceAll(cli.String("mqtt-will-topic"), "{client_id}", mqttClientID)
+	err = validateWillTopic(willTopic, cli.String("mqtt-will-payload"))
+	if err != nil {
+		return file.wrapErr(err, "mqtt-will-topic", "mqtt-will-payload")
+	}
+
+	// The token is used as the password and the username is static
+	if oauth2TokenURL != "" && (cli.String("mqtt-password") != "" || cli.String("mqtt-password-file") != "" || cli.String("mqtt-username-file") != "") {
+		return file.wrapErr(fmt.Errorf("mqtt OAuth2 token url can't be used with mqtt password, mqtt password file or mqtt username file"), "mqtt-oauth2-token-url", "mqtt-password", "mqtt-password-file", "mqtt-username-file")
 	}
 
 	keepAlive := time.Duration(cli.Int("mqtt-keep-alive")) * time.Second
 	connectTimeout := time.Duration(cli.Int("mqtt-connect-timeout")) * time.Second
 
+	connectRetryDeadline := time.Duration(cli.Int("mqtt-connect-retry-deadline")) * time.Second
+	if connectRetryDeadline < 0 {
+		return file.wrapErr(fmt.Errorf("connect retry deadline can't be negative, received: %s", connectRetryDeadline), "mqtt-connect-retry-deadline")
+	}
+
+	reconnectInitialInterval := time.Duration(cli.Int("mqtt-reconnect-initial-interval")) * time.Second
+	reconnectMaxInterval := time.Duration(cli.Int("mqtt-reconnect-max-interval")) * time.Second
+	reconnectJitter := cli.Float64("mqtt-reconnect-jitter")
+	reconnectMaxAttempts := cli.Int("mqtt-reconnect-max-attempts")
+	err = validateReconnect(reconnectInitialInterval, reconnectMaxInterval, reconnectJitter, reconnectMaxAttempts)
+	if err != nil {
+		return file.wrapErr(err, "mqtt-reconnect-initial-interval", "mqtt-reconnect-max-interval", "mqtt-reconnect-jitter", "mqtt-reconnect-max-attempts")
+	}
+
+	metricsNamespace := cli.String("metrics-namespace")
+	if metricsNamespace != "" && !model.IsValidMetricName(model.LabelValue(metricsNamespace)) {
+		return file.wrapErr(fmt.Errorf("metrics namespace %q isn't a valid metric name prefix", metricsNamespace), "metrics-namespace")
+	}
+
+	metricsConstLabels, err := getMetricsConstLabels(cli.StringSlice("metrics-const-labels"))
+	if err != nil {
+		return file.wrapErr(err, "metrics-const-labels")
+	}
+
+	err = validateMetricsTLS(cli.String("metrics-tls-cert-file"), cli.String("metrics-tls-key-file"), cli.String("metrics-tls-client-ca-file"))
+	if err != nil {
+		return file.wrapErr(err, "metrics-tls-cert-file", "metrics-tls-key-file", "metrics-tls-client-ca-file")
+	}
+
+	err = validateSecretFile("metrics basic auth password", cli.String("metrics-basic-auth-password"), cli.String("metrics-basic-auth-password-file"))
+	if err != nil {
+		return file.wrapErr(err, "metrics-basic-auth-password", "metrics-basic-auth-password-file")
+	}
+
+	err = validateSecretFile("metrics bearer token", cli.String("metrics-bearer-token"), cli.String("metrics-bearer-token-file"))
+	if err != nil {
+		return file.wrapErr(err, "metrics-bearer-token", "metrics-bearer-token-file")
+	}
+
+	metricsBasicAuthPasswordSet := cli.String("metrics-basic-auth-password") != "" || cli.String("metrics-basic-auth-password-file") != ""
+	metricsBearerTokenSet := cli.String("metrics-bearer-token") != "" || cli.String("metrics-bearer-token-file") != ""
+	err = validateMetricsAuth(cli.String("metrics-basic-auth-username"), metricsBasicAuthPasswordSet, metricsBearerTokenSet)
+	if err != nil {
+		return file.wrapErr(err, "metrics-basic-auth-username", "metrics-basic-auth-password", "metrics-basic-auth-password-file", "metrics-bearer-token", "metrics-bearer-token-file")
+	}
+
+	metricsAuthenticated := cli.String("metrics-basic-auth-username") != "" || metricsBearerTokenSet || cli.String("metrics-tls-client-ca-file") != ""
+	if cli.Bool("admin-api") && !metricsAuthenticated {
+		return file.wrapErr(fmt.Errorf("admin API requires metrics basic auth, bearer token or TLS client CA to be configured"), "admin-api")
+	}
+
+	// The tail endpoint streams all payloads, which is why it requires authentication like the admin API
+	if cli.Bool("tail-endpoint") && !metricsAuthenticated {
+		return file.wrapErr(fmt.Errorf("tail endpoint requires metrics basic auth, bearer token or TLS client CA to be configured"), "tail-endpoint")
+	}
+
+	logLevel := strings.ToLower(cli.String("log-level"))
+	_, err = status.ParseLevel(logLevel)
+	if err != nil {
+		return file.wrapErr(err, "log-level")
+	}
+
+	logFormat := strings.ToLower(cli.String("log-format"))
+	if logFormat != "json" && logFormat != "text" {
+		return file.wrapErr(fmt.Errorf("log format allowed to be json or text, received: %s", logFormat), "log-format")
+	}
+
+	statusOutput := strings.ToLower(cli.String("status-output"))
+	statusOutputFile := cli.String("status-output-file")
+	err = validateStatusOutput(statusOutput, statusOutputFile)
+	if err != nil {
+		return file.wrapErr(err, "status-output", "status-output-file")
+	}
+
+	tailBufferSize := cli.Int("tail-buffer-size")
+	if tailBufferSize < 1 {
+		return file.wrapErr(fmt.Errorf("tail buffer size needs to be at least 1, received: %d", tailBufferSize), "tail-buffer-size")
+	}
+
+	tailMaxClients := cli.Int("tail-max-clients")
+	if tailMaxClients < 1 {
+		return file.wrapErr(fmt.Errorf("tail max clients needs to be at least 1, received: %d", tailMaxClients), "tail-max-clients")
+	}
+
+	metricsReadTimeout := time.Duration(cli.Int("metrics-read-timeout")) * time.Second
+	metricsWriteTimeout := time.Duration(cli.Int("metrics-write-timeout")) * time.Second
+	metricsIdleTimeout := time.Duration(cli.Int("metrics-idle-timeout")) * time.Second
+	if metricsReadTimeout < 0 || metricsWriteTimeout < 0 || metricsIdleTimeout < 0 {
+		return file.wrapErr(fmt.Errorf("metrics server timeouts can't be negative"), "metrics-read-timeout", "metrics-write-timeout", "metrics-idle-timeout")
+	}
+
+	metricsLivenessThreshold := time.Duration(cli.Int("metrics-liveness-threshold")) * time.Second
+	if metricsLivenessThreshold < 0 {
+		return file.wrapErr(fmt.Errorf("metrics liveness threshold can't be negative, received: %s", metricsLivenessThreshold), "metrics-liveness-threshold")
+	}
+
+	metricsTopicDepth := cli.Int("metrics-topic-depth")
+	metricsTopicMaxLabels := cli.Int("metrics-topic-max-labels")
+	err = validateMetricsTopic(metricsTopicDepth, metricsTopicMaxLabels)
+	if err != nil {
+		return file.wrapErr(err, "metrics-topic-depth", "metrics-topic-max-labels")
+	}
+
+	stalenessThreshold := time.Duration(cli.Int("mqtt-staleness-threshold")) * time.Second
+	if stalenessThreshold < 0 {
+		return file.wrapErr(fmt.Errorf("staleness threshold can't be negative, received: %s", stalenessThreshold), "mqtt-staleness-threshold")
+	}
+
 	newCfg := Client{
-		BrokerAddresses: brokerAddresses,
-		Topic:           cli.String("mqtt-topic"),
-		QoS:             qos,
-		KeepAlive:       keepAlive,
-		ConnectTimeout:  connectTimeout,
-		CleanSession:    cli.Bool("mqtt-clean-session"),
-		Username:        cli.String("mqtt-username"),
-		Password:        cli.String("mqtt-password"),
-		ClientID:        mqttClientID,
-		MetricsAddress:  cli.String("metrics-address"),
-		MetricsPort:     cli.Int("metrics-port"),
+		BrokerAddresses:              brokerAddresses,
+		BrokerSRVRecord:              brokerSRVRecord,
+		BrokerDNSName:                brokerDNSName,
+		BrokerPort:                   flagMqttPort,
+		BrokerDiscoveryScheme:        brokerDiscoveryScheme,
+		BrokerDiscoveryInterval:      brokerDiscoveryInterval,
+		Topic:                        cli.String("mqtt-topic"),
+		QoS:                          qos,
+		KeepAlive:                    keepAlive,
+		ConnectTimeout:               connectTimeout,
+		ConnectRetry:                 cli.Bool("mqtt-connect-retry"),
+		ConnectRetryDeadline:         connectRetryDeadline,
+		ReconnectInitialInterval:     reconnectInitialInterval,
+		ReconnectMaxInterval:         reconnectMaxInterval,
+		ReconnectJitter:              reconnectJitter,
+		ReconnectMaxAttempts:         reconnectMaxAttempts,
+		CleanSession:                 cli.Bool("mqtt-clean-session"),
+		SessionStoreDirectory:        sessionStoreDirectory,
+		Username:                     cli.String("mqtt-username"),
+		Password:                     cli.String("mqtt-password"),
+		UsernameFile:                 cli.String("mqtt-username-file"),
+		PasswordFile:                 cli.String("mqtt-password-file"),
+		OAuth2TokenURL:               oauth2TokenURL,
+		OAuth2ClientID:               cli.String("mqtt-oauth2-client-id"),
+		OAuth2ClientSecret:           cli.String("mqtt-oauth2-client-secret"),
+		OAuth2ClientSecretFile:       cli.String("mqtt-oauth2-client-secret-file"),
+		OAuth2Scopes:                 cli.StringSlice("mqtt-oauth2-scopes"),
+		OAuth2Audience:               cli.String("mqtt-oauth2-audience"),
+		OAuth2RefreshBefore:          oauth2RefreshBefore,
+		TLSCAFile:                    cli.String("mqtt-tls-ca-file"),
+		TLSCertFile:                  cli.String("mqtt-tls-cert-file"),
+		TLSKeyFile:                   cli.String("mqtt-tls-key-file"),
+		TLSALPNProtocols:             cli.StringSlice("mqtt-tls-alpn"),
+		TLSInsecureSkipVerify:        cli.Bool("mqtt-tls-insecure-skip-verify"),
+		Profile:                      strings.ToLower(cli.String("mqtt-profile")),
+		ProfileHost:                  cli.String("mqtt-profile-host"),
+		AzureSharedAccessKey:         cli.String("mqtt-azure-shared-access-key"),
+		AzureSharedAccessKeyFile:     cli.String("mqtt-azure-shared-access-key-file"),
+		AzureSharedAccessKeyName:     cli.String("mqtt-azure-shared-access-key-name"),
+		AzureSASTokenTTL:             time.Duration(cli.Int("mqtt-azure-sas-token-ttl")) * time.Second,
+		WillTopic:                    willTopic,
+		WillPayload:                  cli.String("mqtt-will-payload"),
+		WillQoS:                      willQoS,
+		WillRetained:                 cli.Bool("mqtt-will-retained"),
+		PresenceMessages:             cli.Bool("mqtt-presence-messages"),
+		RetainedMessages:             retainedMessages,
+		MessageEnvelope:              cli.Bool("message-envelope"),
+		ClientID:                     mqttClientID,
+		MetricsAddress:               cli.String("metrics-address"),
+		MetricsPort:                  cli.Int("metrics-port"),
+		MetricsNamespace:             metricsNamespace,
+		MetricsConstLabels:           metricsConstLabels,
+		MetricsTLSCertFile:           cli.String("metrics-tls-cert-file"),
+		MetricsTLSKeyFile:            cli.String("metrics-tls-key-file"),
+		MetricsTLSClientCAFile:       cli.String("metrics-tls-client-ca-file"),
+		MetricsBasicAuthUsername:     cli.String("metrics-basic-auth-username"),
+		MetricsBasicAuthPassword:     cli.String("metrics-basic-auth-password"),
+		MetricsBearerToken:           cli.String("metrics-bearer-token"),
+		MetricsBasicAuthPasswordFile: cli.String("metrics-basic-auth-password-file"),
+		MetricsBearerTokenFile:       cli.String("metrics-bearer-token-file"),
+		MetricsReadTimeout:           metricsReadTimeout,
+		MetricsWriteTimeout:          metricsWriteTimeout,
+		MetricsIdleTimeout:           metricsIdleTimeout,
+		MetricsLivenessThreshold:     metricsLivenessThreshold,
+		AdminAPI:                     cli.Bool("admin-api"),
+		TailEndpoint:                 cli.Bool("tail-endpoint"),
+		TailBufferSize:               tailBufferSize,
+		TailMaxClients:               tailMaxClients,
+		LogLevel:                     logLevel,
+		LogFormat:                    logFormat,
+		StatusOutput:                 statusOutput,
+		StatusOutputFile:             statusOutputFile,
+		StatusTag:                    cli.Bool("status-tag"),
+		MetricsTopicDepth:            metricsTopicDepth,
+		MetricsTopicMaxLabels:        metricsTopicMaxLabels,
+		LatencyTimestampField:        cli.String("metrics-latency-timestamp-field"),
+		StalenessThreshold:           stalenessThreshold,
+		DebugEndpoints:               cli.Bool("debug-endpoints"),
+		DebugAddress:                 cli.String("debug-address"),
+		DebugPort:                    cli.Int("debug-port"),
+		ConfigFile:                   configFilePath,
+		ConfigWatchInterval:          configWatchInterval,
+	}
+
+	err = applyProfile(cli, &newCfg)
+	if err != nil {
+		return file.wrapErr(err, "mqtt-profile", "mqtt-profile-host", "mqtt-azure-shared-access-key", "mqtt-azure-shared-access-key-file", "mqtt-azure-sas-token-ttl")
 	}
 
 	client.setConfig(newCfg)
@@ -289,6 +1176,25 @@ func (client *Client) helpPrinter(out io.Writer, templ string, data interface{})
 	}
 }
 
+// validateRequiredFlags returns the same error as the flags Required option, after the config file has been applied
+func validateRequiredFlags(c *cli.Context, names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if !c.IsSet(name) {
+			missing = append(missing, name)
+		}
+	}
+
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("Required flag %q not set", missing[0])
+	default:
+		return fmt.Errorf("Required flags %q not set", strings.Join(missing, ", "))
+	}
+}
+
 func getClientID(clientID string, randomSuffix bool) (string, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -316,25 +1222,214 @@ func getRandomClientID(clientID string) (string, error) {
 
 }
 
-func getBrokerAddresses(brokerAddresses []string, port int) []string {
-	var newBrokers []string
-	for _, broker := range brokerAddresses {
-		b := fmt.Sprintf("tcp://%s:%d", broker, port)
-		if strings.Contains(broker, ":") {
-			b = fmt.Sprintf("tcp://%s", broker)
+func getQoS(qos int) (int, error) {
+	if qos < 0 || qos > 2 {
+		return 0, fmt.Errorf("QoS allowed to be 0, 1 or 2, received: %d", qos)
+	}
+
+	return qos, nil
+}
+
+// validateWillTopic returns an error if the topic has wildcards or if a payload is set without a topic
+func validateWillTopic(topic string, payload string) error {
+	if topic == "" {
+		if payload != "" {
+			return fmt.Errorf("will payload requires a will topic")
 		}
-		newBrokers = append(newBrokers, b)
+
+		return nil
 	}
 
-	return newBrokers
+	if strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("will topic %q can't contain wildcards", topic)
+	}
+
+	return nil
 }
 
-func getQoS(qos int) (int, error) {
-	if qos < 0 || qos > 1 {
-		return 0, fmt.Errorf("QoS allowed to be 0 or 1, received: %d", qos)
+func validateReconnect(initialInterval, maxInterval time.Duration, jitter float64, maxAttempts int) error {
+	// The interval is doubled for every attempt, which means a zero interval would reconnect in a tight loop
+	if initialInterval < time.Second {
+		return fmt.Errorf("reconnect initial interval needs to be at least 1s, received: %s", initialInterval)
 	}
 
-	return qos, nil
+	if maxInterval < initialInterval {
+		return fmt.Errorf("reconnect max interval (%s) can't be lower than the initial interval (%s)", maxInterval, initialInterval)
+	}
+
+	if jitter < 0 || jitter > 1 {
+		return fmt.Errorf("reconnect jitter allowed to be between 0 and 1, received: %g", jitter)
+	}
+
+	if maxAttempts < 0 {
+		return fmt.Errorf("reconnect max attempts can't be negative, received: %d", maxAttempts)
+	}
+
+	return nil
+}
+
+func getMetricsConstLabels(labels []string) (map[string]string, error) {
+	constLabels := make(map[string]string)
+	for _, label := range labels {
+		key, value, found := strings.Cut(label, "=")
+		if !found {
+			return nil, fmt.Errorf("metrics const label %q needs to be in the format key=value", label)
+		}
+
+		if !model.LabelName(key).IsValid() {
+			return nil, fmt.Errorf("metrics const label %q has an invalid name: %s", label, key)
+		}
+
+		constLabels[key] = value
+	}
+
+	return constLabels, nil
+}
+
+func validateMetricsTopic(depth int, maxLabels int) error {
+	if depth < 0 {
+		return fmt.Errorf("metrics topic depth can't be negative, received: %d", depth)
+	}
+
+	if maxLabels < 1 {
+		return fmt.Errorf("metrics topic max labels needs to be at least 1, received: %d", maxLabels)
+	}
+
+	return nil
+}
+
+func getSessionStoreDirectory(directory string) (string, error) {
+	if directory == "" {
+		return "", nil
+	}
+
+	err := os.MkdirAll(directory, 0700)
+	if err != nil {
+		return "", fmt.Errorf("unable to create session store directory %q: %w", directory, err)
+	}
+
+	info, err := os.Stat(directory)
+	if err != nil {
+		return "", fmt.Errorf("unable to access session store directory %q: %w", directory, err)
+	}
+
+	if !info.IsDir() {
+		return "", fmt.Errorf("session store directory %q is not a directory", directory)
+	}
+
+	return filepath.Clean(directory), nil
+}
+
+func validateStatusOutput(output string, outputFile string) error {
+	switch output {
+	case status.OutputSplit, status.OutputStdout, status.OutputStderr, status.OutputDisabled:
+		return nil
+	case status.OutputFile:
+		if outputFile == "" {
+			return fmt.Errorf("status output file is required when status output is file")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("status output allowed to be split, stdout, stderr, file or disabled, received: %s", output)
+	}
+}
+
+func validateMetricsTLS(certFile string, keyFile string, clientCAFile string) error {
+	if (certFile == "") != (keyFile == "") {
+		return fmt.Errorf("both metrics TLS cert file and key file are required to enable TLS")
+	}
+
+	if clientCAFile != "" && certFile == "" {
+		return fmt.Errorf("metrics TLS client CA file requires TLS to be enabled")
+	}
+
+	for _, file := range []string{certFile, keyFile, clientCAFile} {
+		if file == "" {
+			continue
+		}
+
+		_, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("unable to access metrics TLS file %q: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+// validateSecretFile returns an error if both the value and the file are set or if the file can't be read
+func validateSecretFile(name string, value string, file string) error {
+	if value != "" && file != "" {
+		return fmt.Errorf("%s and %s file can't be used at the same time", name, name)
+	}
+
+	if file == "" {
+		return nil
+	}
+
+	_, err := h.ReadSecretFile(file)
+	return err
+}
+
+// validateOAuth2 returns an error if the token url is set without a client ID and secret or isn't an http(s) URL
+func validateOAuth2(tokenURL string, clientID string, clientSecret string, clientSecretFile string, refreshBefore time.Duration) error {
+	err := validateSecretFile("mqtt OAuth2 client secret", clientSecret, clientSecretFile)
+	if err != nil {
+		return err
+	}
+
+	if tokenURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(tokenURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("mqtt OAuth2 token url %q needs to be an http or https URL", tokenURL)
+	}
+
+	if clientID == "" || (clientSecret == "" && clientSecretFile == "") {
+		return fmt.Errorf("mqtt OAuth2 client ID and client secret are required when the token url is set")
+	}
+
+	if refreshBefore < 0 {
+		return fmt.Errorf("mqtt OAuth2 refresh before can't be negative, received: %s", refreshBefore)
+	}
+
+	return nil
+}
+
+// validateMetricsAuth takes if the password and token are set, using the value or a file
+func validateMetricsAuth(basicAuthUsername string, basicAuthPasswordSet bool, bearerTokenSet bool) error {
+	if (basicAuthUsername != "") != basicAuthPasswordSet {
+		return fmt.Errorf("both metrics basic auth username and password are required to enable basic auth")
+	}
+
+	if basicAuthUsername != "" && bearerTokenSet {
+		return fmt.Errorf("metrics basic auth and bearer token can't be used at the same time")
+	}
+
+	return nil
+}
+
+// DebugStateName returns the name of the config in debug state reports
+func (client *Client) DebugStateName() string {
+	return "config"
+}
+
+// DebugState returns the effective config with the secrets redacted
+func (client *Client) DebugState() interface{} {
+	cfg := *client
+
+	for _, secret := range []*string{&cfg.Password, &cfg.OAuth2ClientSecret, &cfg.AzureSharedAccessKey, &cfg.MetricsBasicAuthPassword, &cfg.MetricsBearerToken} {
+		if *secret != "" {
+			*secret = h.Redacted
+		}
+	}
+
+	cfg.BrokerAddresses = h.RedactURLs(client.BrokerAddresses)
+
+	return cfg
 }
 
 func generateRandomString(n int) (string, error) {
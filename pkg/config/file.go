@@ -0,0 +1,254 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileFlag is the flag (and env var) pointing to the config file, it can't be set in the file itself
+const configFileFlag = "config"
+
+// configFile contains the keys that were read from the config file, used to point validation errors to the file and key
+type configFile struct {
+	path string
+	keys map[string]bool
+}
+
+// wrapErr adds the file and key to err if the value of the (first) key was read from the config file
+func (file *configFile) wrapErr(err error, keys ...string) error {
+	if err == nil || file == nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if file.keys[key] {
+			return fmt.Errorf("config file %q key %q: %w", file.path, key, err)
+		}
+	}
+
+	return err
+}
+
+// applyConfigFile reads the config file and sets the flags that haven't been set by flags or env vars,
+// giving the precedence: flags > env vars > config file > defaults
+func applyConfigFile(c *cli.Context, flags []cli.Flag, path string) (*configFile, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	values, err := readConfigFile(path, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &configFile{
+		path: path,
+		keys: make(map[string]bool),
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if c.IsSet(key) {
+			continue
+		}
+
+		for _, value := range values[key] {
+			err := c.Set(key, value)
+			if err != nil {
+				return nil, fmt.Errorf("config file %q key %q: %w", path, key, err)
+			}
+		}
+
+		file.keys[key] = true
+	}
+
+	return file, nil
+}
+
+// readConfigFile parses the YAML or TOML file (based on the extension) and returns the flag values by flag name
+func readConfigFile(path string, flags []cli.Flag) (map[string][]string, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %q: %w", path, err)
+	}
+
+	raw := make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &raw)
+	case ".toml":
+		err = toml.Unmarshal(b, &raw)
+	default:
+		return nil, fmt.Errorf("config file %q needs the extension .yaml, .yml or .toml, received: %q", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file %q: %w", path, err)
+	}
+
+	values := make(map[string][]string)
+	err = flattenConfigFile(raw, "", getFlagKinds(flags), values)
+	if err != nil {
+		return nil, fmt.Errorf("config file %q %w", path, err)
+	}
+
+	return values, nil
+}
+
+// flattenConfigFile joins nested keys with "-" (mqtt: {topic: x} is the same as mqtt-topic: x) and converts the values to strings
+func flattenConfigFile(raw map[string]interface{}, prefix string, kinds map[string]string, values map[string][]string) error {
+	for k, v := range raw {
+		key := strings.ToLower(k)
+		if prefix != "" {
+			key = prefix + "-" + key
+		}
+
+		kind, found := kinds[key]
+		if !found || key == configFileFlag {
+			nested, ok := v.(map[string]interface{})
+			if !ok || key == configFileFlag {
+				return fmt.Errorf("key %q: unknown key", key)
+			}
+
+			err := flattenConfigFile(nested, key, kinds, values)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		value, err := getConfigFileValue(v, kind)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+
+		if _, duplicate := values[key]; duplicate {
+			return fmt.Errorf("key %q: set more than once", key)
+		}
+
+		values[key] = value
+	}
+
+	return nil
+}
+
+func getConfigFileValue(v interface{}, kind string) ([]string, error) {
+	switch value := v.(type) {
+	case nil:
+		return nil, fmt.Errorf("value is missing")
+	case []interface{}:
+		if kind != "list" {
+			return nil, fmt.Errorf("expected a %s, received a list", kind)
+		}
+
+		var list []string
+		for _, item := range value {
+			s, err := getConfigFileScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, s)
+		}
+
+		return list, nil
+	case map[string]interface{}:
+		// Maps are only supported for key=value lists, like metrics-const-labels
+		if kind != "list" {
+			return nil, fmt.Errorf("expected a %s, received a map", kind)
+		}
+
+		var list []string
+		for k, item := range value {
+			s, err := getConfigFileScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, fmt.Sprintf("%s=%s", k, s))
+		}
+		sort.Strings(list)
+
+		return list, nil
+	default:
+		s, err := getConfigFileScalar(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{s}, nil
+	}
+}
+
+func getConfigFileScalar(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case string, bool, int, int64, uint64, float64:
+		return fmt.Sprint(value), nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+// getFlagKinds returns the value kind of the flags by flag name, documented in the config file schema
+func getFlagKinds(flags []cli.Flag) map[string]string {
+	kinds := make(map[string]string)
+	for _, f := range flags {
+		name := f.Names()[0]
+		switch f.(type) {
+		case *cli.StringSliceFlag:
+			kinds[name] = "list"
+		case *cli.IntFlag:
+			kinds[name] = "integer"
+		case *cli.Float64Flag:
+			kinds[name] = "float"
+		case *cli.BoolFlag:
+			kinds[name] = "boolean"
+		default:
+			kinds[name] = "string"
+		}
+	}
+
+	return kinds
+}
+
+// configFileMarkdown documents the config file schema, appended to the generated CLI documentation
+func configFileMarkdown(flags []cli.Flag) string {
+	kinds := getFlagKinds(flags)
+
+	var sb strings.Builder
+	sb.WriteString("\n# CONFIG FILE\n\n")
+	sb.WriteString("The config can also be read from a YAML (`.yaml` or `.yml`) or TOML (`.toml`) file using `--config` (or the env var `CONFIG_FILE`).\n\n")
+	sb.WriteString("The precedence is: flags > env vars > config file > defaults.\n\n")
+	sb.WriteString("The keys are the flag names. Keys can be nested, where the levels are joined with `-` (`mqtt: {topic: x}` is the same as `mqtt-topic: x`). Lists are used for flags that can be set multiple times, `metrics-const-labels` can also be a map. Unknown keys are not allowed.\n\n")
+	sb.WriteString("```yaml\nmqtt:\n  broker-addresses:\n    - broker-1:1883\n    - broker-2:1883\n  topic: devices/#\n  qos: 1\nmetrics:\n  const-labels:\n    env: prod\nlog-level: debug\n```\n\n")
+	sb.WriteString("| Key | Type | Default | Env vars |\n")
+	sb.WriteString("| --- | --- | --- | --- |\n")
+
+	for _, f := range flags {
+		name := f.Names()[0]
+		if name == configFileFlag {
+			continue
+		}
+
+		var defaultValue string
+		var envVars []string
+		if docFlag, ok := f.(cli.DocGenerationFlag); ok {
+			defaultValue = docFlag.GetDefaultText()
+			envVars = docFlag.GetEnvVars()
+		}
+
+		fmt.Fprintf(&sb, "| %s | %s | %s | %s |\n", name, kinds[name], defaultValue, strings.Join(envVars, ", "))
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigFile(t *testing.T) {
+	envVarsToClear := []string{
+		"MQTT_BROKER_ADDRESSES",
+		"MQTT_HOST_1",
+		"MQTT_HOST_2",
+		"MQTT_HOST_3",
+		"MQTT_TOPIC",
+		"LOG_TOPIC",
+		"MQTT_QOS",
+		"METRICS_CONST_LABELS",
+		"LOG_LEVEL",
+		"CONFIG_FILE",
+	}
+
+	for _, envVar := range envVarsToClear {
+		restore := tempUnsetEnv(envVar)
+		defer restore()
+	}
+
+	tmpDir := t.TempDir()
+
+	cases := []struct {
+		testDescription        string
+		fileName               string
+		content                string
+		args                   []string
+		env                    map[string]string
+		expectedBrokers        []string
+		expectedTopic          string
+		expectedQoS            int
+		expectedLogLevel       string
+		expectedConstLabels    map[string]string
+		expectedErrContains    string
+		expectedErrNotContains string
+	}{
+		{
+			testDescription:  "yaml with flat keys",
+			fileName:         "flat.yaml",
+			content:          "mqtt-broker-addresses:\n  - localhost\n  - localhost:1884\nmqtt-topic: test/#\nmqtt-qos: 1\n",
+			expectedBrokers:  []string{"tcp://localhost:1883", "tcp://localhost:1884"},
+			expectedTopic:    "test/#",
+			expectedQoS:      1,
+			expectedLogLevel: "info",
+		},
+		{
+			testDescription:     "yaml with nested keys and const labels map",
+			fileName:            "nested.yml",
+			content:             "mqtt:\n  broker-addresses: [localhost]\n  topic: test/#\nmetrics:\n  const-labels:\n    env: prod\n    region: west\nlog-level: debug\n",
+			expectedBrokers:     []string{"tcp://localhost:1883"},
+			expectedTopic:       "test/#",
+			expectedLogLevel:    "debug",
+			expectedConstLabels: map[string]string{"env": "prod", "region": "west"},
+		},
+		{
+			testDescription:  "toml",
+			fileName:         "config.toml",
+			content:          "log-level = \"warn\"\n\n[mqtt]\nbroker-addresses = [\"localhost\"]\ntopic = \"test/#\"\nqos = 2\n",
+			expectedBrokers:  []string{"tcp://localhost:1883"},
+			expectedTopic:    "test/#",
+			expectedQoS:      2,
+			expectedLogLevel: "warn",
+		},
+		{
+			testDescription:  "flags and env vars take precedence over the file",
+			fileName:         "precedence.yaml",
+			content:          "mqtt-broker-addresses: [localhost]\nmqtt-topic: file/#\nmqtt-qos: 1\nlog-level: debug\n",
+			args:             []string{"--mqtt-topic=flag/#"},
+			env:              map[string]string{"MQTT_QOS": "2"},
+			expectedBrokers:  []string{"tcp://localhost:1883"},
+			expectedTopic:    "flag/#",
+			expectedQoS:      2,
+			expectedLogLevel: "debug",
+		},
+		{
+			testDescription:        "invalid flag value not from the file isn't pointed to the file",
+			fileName:               "flag-error.yaml",
+			content:                "mqtt-broker-addresses: [localhost]\nmqtt-topic: test/#\n",
+			args:                   []string{"--mqtt-qos=3"},
+			expectedErrContains:    "QoS allowed to be 0, 1 or 2, received: 3",
+			expectedErrNotContains: "flag-error.yaml",
+		},
+		{
+			testDescription:     "required flags missing from the file",
+			fileName:            "required.yaml",
+			content:             "mqtt-broker-addresses: [localhost]\n",
+			expectedErrContains: "Required flag \"mqtt-topic\" not set",
+		},
+		{
+			testDescription:     "validation error points to the file and key",
+			fileName:            "invalid-qos.yaml",
+			content:             "mqtt-broker-addresses: [localhost]\nmqtt-topic: test/#\nmqtt:\n  qos: 3\n",
+			expectedErrContains: "invalid-qos.yaml\" key \"mqtt-qos\": QoS allowed to be 0, 1 or 2, received: 3",
+		},
+		{
+			testDescription:     "wrong type points to the file and key",
+			fileName:            "invalid-type.yaml",
+			content:             "mqtt-broker-addresses: [localhost]\nmqtt-topic: test/#\nmetrics-port: abc\n",
+			expectedErrContains: "invalid-type.yaml\" key \"metrics-port\"",
+		},
+		{
+			testDescription:     "list for a single value",
+			fileName:            "invalid-list.toml",
+			content:             "mqtt-topic = [\"a\", \"b\"]\n",
+			expectedErrContains: "invalid-list.toml\" key \"mqtt-topic\": expected a string, received a list",
+		},
+		{
+			testDescription:     "unknown key",
+			fileName:            "unknown.yaml",
+			content:             "mqtt:\n  topics: test/#\n",
+			expectedErrContains: "unknown.yaml\" key \"mqtt-topics\": unknown key",
+		},
+		{
+			testDescription:     "config file can't point to another config file",
+			fileName:            "recursive.yaml",
+			content:             "config: other.yaml\n",
+			expectedErrContains: "recursive.yaml\" key \"config\": unknown key",
+		},
+		{
+			testDescription:     "unsupported extension",
+			fileName:            "config.json",
+			content:             "{}",
+			expectedErrContains: "needs the extension .yaml, .yml or .toml, received: \".json\"",
+		},
+		{
+			testDescription:     "invalid yaml",
+			fileName:            "invalid.yaml",
+			content:             "mqtt-topic: [",
+			expectedErrContains: "unable to parse config file",
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		filePath := filepath.Join(tmpDir, c.fileName)
+		err := os.WriteFile(filePath, []byte(c.content), 0600)
+		if err != nil {
+			t.Fatalf("Expected err to be nil: %q", err)
+		}
+
+		for key, value := range c.env {
+			os.Setenv(key, value)
+		}
+
+		client := newClient(Options{
+			DisableExitOnHelp: true,
+		})
+		client.setIO(&bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{})
+		args := append([]string{"fake-bin", "--config", filePath}, c.args...)
+		cfg, err := client.generateConfig(args)
+
+		for key := range c.env {
+			os.Unsetenv(key)
+		}
+
+		if c.expectedErrContains != "" {
+			if err == nil {
+				t.Errorf("Expected err to contain '%s' but was nil", c.expectedErrContains)
+				continue
+			}
+
+			if !strings.Contains(err.Error(), c.expectedErrContains) {
+				t.Errorf("Expected err to contain '%s' but was: %q", c.expectedErrContains, err)
+			}
+
+			if c.expectedErrNotContains != "" && strings.Contains(err.Error(), c.expectedErrNotContains) {
+				t.Errorf("Expected err not to contain '%s' but was: %q", c.expectedErrNotContains, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Expected err to be nil: %q", err)
+			continue
+		}
+
+		if cfg.ConfigFile != filePath {
+			t.Errorf("Expected cfg.ConfigFile to be '%s' but was: %s", filePath, cfg.ConfigFile)
+		}
+
+		if !reflect.DeepEqual(cfg.BrokerAddresses, c.expectedBrokers) {
+			t.Errorf("Expected cfg.BrokerAddresses to be '%v' but was: %v", c.expectedBrokers, cfg.BrokerAddresses)
+		}
+
+		if cfg.Topic != c.expectedTopic {
+			t.Errorf("Expected cfg.Topic to be '%s' but was: %s", c.expectedTopic, cfg.Topic)
+		}
+
+		if cfg.QoS != c.expectedQoS {
+			t.Errorf("Expected cfg.QoS to be '%d' but was: %d", c.expectedQoS, cfg.QoS)
+		}
+
+		if cfg.LogLevel != c.expectedLogLevel {
+			t.Errorf("Expected cfg.LogLevel to be '%s' but was: %s", c.expectedLogLevel, cfg.LogLevel)
+		}
+
+		if c.expectedConstLabels != nil && !reflect.DeepEqual(cfg.MetricsConstLabels, c.expectedConstLabels) {
+			t.Errorf("Expected cfg.MetricsConstLabels to be '%v' but was: %v", c.expectedConstLabels, cfg.MetricsConstLabels)
+		}
+	}
+}
+
+func TestConfigFileMarkdown(t *testing.T) {
+	client := newClient(NullOptions)
+	md := configFileMarkdown(client.newCLIFlags())
+
+	for _, expected := range []string{
+		"flags > env vars > config file > defaults",
+		"| mqtt-broker-addresses | list |  | MQTT_BROKER_ADDRESSES, MQTT_HOST_1, MQTT_HOST_2, MQTT_HOST_3 |",
+		"| mqtt-qos | integer | 0 | MQTT_QOS |",
+		"| mqtt-clean-session | boolean | false | MQTT_CLEAN_SESSION |",
+	} {
+		if !strings.Contains(md, expected) {
+			t.Errorf("Expected markdown to contain '%s' but was: %s", expected, md)
+		}
+	}
+
+	if strings.Contains(md, "| config |") {
+		t.Errorf("Expected markdown not to contain the config key")
+	}
+}
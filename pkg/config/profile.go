@@ -0,0 +1,136 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// ProfileAzureIoTHub connects as a device using a shared access signature (SAS) token, generated by the mqtt client
+	ProfileAzureIoTHub = "azure-iot-hub"
+	// ProfileAzureEventGrid connects to an Event Grid namespace using a client certificate
+	ProfileAzureEventGrid = "azure-event-grid"
+	// ProfileAWSIoTCore connects using a client certificate on port 443 with ALPN
+	ProfileAWSIoTCore = "aws-iot-core"
+)
+
+var profiles = []string{ProfileAzureIoTHub, ProfileAzureEventGrid, ProfileAWSIoTCore}
+
+// awsIoTCoreALPN is required by AWS IoT Core to use MQTT with client certificates on port 443
+const awsIoTCoreALPN = "x-amzn-mqtt-ca"
+
+// profileFlags are the flags filled in by the profiles, they can't be set when a profile is used
+var profileFlags = map[string][]string{
+	ProfileAzureIoTHub:    {"mqtt-broker-addresses", "mqtt-broker-srv-record", "mqtt-broker-dns-name", "mqtt-username", "mqtt-username-file", "mqtt-password", "mqtt-password-file", "mqtt-oauth2-token-url", "mqtt-client-id-random-suffix"},
+	ProfileAzureEventGrid: {"mqtt-broker-addresses", "mqtt-broker-srv-record", "mqtt-broker-dns-name", "mqtt-password", "mqtt-password-file", "mqtt-oauth2-token-url"},
+	ProfileAWSIoTCore:     {"mqtt-broker-addresses", "mqtt-broker-srv-record", "mqtt-broker-dns-name", "mqtt-username", "mqtt-username-file", "mqtt-password", "mqtt-password-file", "mqtt-oauth2-token-url"},
+}
+
+// applyProfile fills in the broker, username and TLS settings of the connection profile (if any) from the profile host,
+// the client ID and the profile specific flags. The password of Azure IoT Hub is a SAS token generated by the mqtt client.
+func applyProfile(c *cli.Context, cfg *Client) error {
+	usesAzureKey := cfg.AzureSharedAccessKey != "" || cfg.AzureSharedAccessKeyFile != "" || cfg.AzureSharedAccessKeyName != ""
+	if cfg.Profile == "" {
+		if cfg.ProfileHost != "" || usesAzureKey {
+			return fmt.Errorf("mqtt profile host and Azure shared access key require an mqtt profile")
+		}
+
+		return nil
+	}
+
+	flags, ok := profileFlags[cfg.Profile]
+	if !ok {
+		return fmt.Errorf("mqtt profile allowed to be %s, received: %s", strings.Join(profiles, ", "), cfg.Profile)
+	}
+
+	for _, flag := range flags {
+		if c.IsSet(flag) {
+			return fmt.Errorf("mqtt profile %s can't be used with %s", cfg.Profile, flag)
+		}
+	}
+
+	if cfg.ProfileHost == "" || strings.ContainsAny(cfg.ProfileHost, ":/ ") {
+		return fmt.Errorf("mqtt profile %s requires a profile host name (without scheme and port), received: %q", cfg.Profile, cfg.ProfileHost)
+	}
+
+	if cfg.Profile != ProfileAzureIoTHub && usesAzureKey {
+		return fmt.Errorf("mqtt profile %s can't be used with an Azure shared access key", cfg.Profile)
+	}
+
+	switch cfg.Profile {
+	case ProfileAzureIoTHub:
+		if cfg.AzureSharedAccessKey == "" && cfg.AzureSharedAccessKeyFile == "" {
+			return fmt.Errorf("mqtt profile %s requires an Azure shared access key", cfg.Profile)
+		}
+
+		// The client ID is the device ID, the host name used by default would generate a token for a device that doesn't exist
+		if c.String("mqtt-client-id") == "" {
+			return fmt.Errorf("mqtt profile %s requires mqtt-client-id to be set to the device ID", cfg.Profile)
+		}
+
+		if cfg.AzureSASTokenTTL <= 0 {
+			return fmt.Errorf("Azure SAS token TTL needs to be positive, received: %s", cfg.AzureSASTokenTTL)
+		}
+
+		// The username is set by the SAS token provider
+		cfg.BrokerAddresses = []string{profileBroker(cfg.ProfileHost, 8883)}
+	case ProfileAzureEventGrid:
+		if cfg.TLSCertFile == "" {
+			return fmt.Errorf("mqtt profile %s requires a TLS client certificate", cfg.Profile)
+		}
+
+		cfg.BrokerAddresses = []string{profileBroker(cfg.ProfileHost, 8883)}
+		// The username is the client authentication name, which is the client ID by default
+		if cfg.Username == "" && cfg.UsernameFile == "" {
+			cfg.Username = cfg.ClientID
+		}
+	case ProfileAWSIoTCore:
+		if cfg.TLSCertFile == "" {
+			return fmt.Errorf("mqtt profile %s requires a TLS client certificate", cfg.Profile)
+		}
+
+		cfg.BrokerAddresses = []string{profileBroker(cfg.ProfileHost, 443)}
+		if len(cfg.TLSALPNProtocols) == 0 {
+			cfg.TLSALPNProtocols = []string{awsIoTCoreALPN}
+		}
+	}
+
+	return nil
+}
+
+func profileBroker(host string, port int) string {
+	return fmt.Sprintf("ssl://%s", net.JoinHostPort(host, fmt.Sprint(port)))
+}
+
+// validateMqttTLS checks that the CA and the client certificate and key can be loaded
+func validateMqttTLS(caFile string, certFile string, keyFile string) error {
+	if (certFile == "") != (keyFile == "") {
+		return fmt.Errorf("both mqtt TLS cert file and key file are required to use a client certificate")
+	}
+
+	if caFile != "" {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("unable to read mqtt TLS CA file %q: %w", caFile, err)
+		}
+
+		if !x509.NewCertPool().AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no certificates found in mqtt TLS CA file %q", caFile)
+		}
+	}
+
+	if certFile != "" {
+		_, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("unable to load mqtt TLS certificate %q and key %q: %w", certFile, keyFile, err)
+		}
+	}
+
+	return nil
+}
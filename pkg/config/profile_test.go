@@ -0,0 +1,206 @@
+package config
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfile(t *testing.T) {
+	envVarsToClear := []string{
+		"MQTT_BROKER_ADDRESSES",
+		"MQTT_HOST_1",
+		"MQTT_HOST_2",
+		"MQTT_HOST_3",
+		"MQTT_TOPIC",
+		"LOG_TOPIC",
+		"MQTT_CLIENT_ID",
+		"MQTT_USERNAME",
+		"MQTT_PASSWORD",
+		"MQTT_TLS_CERT_FILE",
+		"MQTT_TLS_KEY_FILE",
+		"MQTT_TLS_ALPN",
+		"MQTT_PROFILE",
+		"MQTT_PROFILE_HOST",
+		"MQTT_AZURE_SHARED_ACCESS_KEY",
+		"MQTT_AZURE_SHARED_ACCESS_KEY_FILE",
+		"MQTT_AZURE_SHARED_ACCESS_KEY_NAME",
+		"MQTT_AZURE_SAS_TOKEN_TTL",
+		"CONFIG_FILE",
+	}
+
+	for _, envVar := range envVarsToClear {
+		restore := tempUnsetEnv(envVar)
+		defer restore()
+	}
+
+	certFile, keyFile := testWriteKeyPair(t, t.TempDir())
+	tlsArgs := []string{"--mqtt-tls-cert-file", certFile, "--mqtt-tls-key-file", keyFile}
+
+	cases := []struct {
+		testDescription     string
+		args                []string
+		expectedBrokers     []string
+		expectedUsername    string
+		expectedALPN        []string
+		expectedErrContains string
+	}{
+		{
+			testDescription: "Azure IoT Hub",
+			args:            []string{"--mqtt-profile=azure-iot-hub", "--mqtt-profile-host=example.azure-devices.net", "--mqtt-client-id=device-1", "--mqtt-azure-shared-access-key=dGVzdC1rZXk="},
+			expectedBrokers: []string{"ssl://example.azure-devices.net:8883"},
+		},
+		{
+			testDescription:     "Azure IoT Hub without shared access key",
+			args:                []string{"--mqtt-profile=azure-iot-hub", "--mqtt-profile-host=example.azure-devices.net", "--mqtt-client-id=device-1"},
+			expectedErrContains: "mqtt profile azure-iot-hub requires an Azure shared access key",
+		},
+		{
+			testDescription:     "Azure IoT Hub without client ID",
+			args:                []string{"--mqtt-profile=azure-iot-hub", "--mqtt-profile-host=example.azure-devices.net", "--mqtt-azure-shared-access-key=dGVzdC1rZXk="},
+			expectedErrContains: "mqtt profile azure-iot-hub requires mqtt-client-id to be set to the device ID",
+		},
+		{
+			testDescription:     "Azure IoT Hub with a random client ID suffix",
+			args:                []string{"--mqtt-profile=azure-iot-hub", "--mqtt-profile-host=example.azure-devices.net", "--mqtt-azure-shared-access-key=dGVzdC1rZXk=", "--mqtt-client-id-random-suffix"},
+			expectedErrContains: "mqtt profile azure-iot-hub can't be used with mqtt-client-id-random-suffix",
+		},
+		{
+			testDescription:  "Azure Event Grid",
+			args:             append([]string{"--mqtt-profile=azure-event-grid", "--mqtt-profile-host=example.westeurope-1.ts.eventgrid.azure.net", "--mqtt-client-id=client-1"}, tlsArgs...),
+			expectedBrokers:  []string{"ssl://example.westeurope-1.ts.eventgrid.azure.net:8883"},
+			expectedUsername: "client-1",
+		},
+		{
+			testDescription:  "Azure Event Grid with authentication name",
+			args:             append([]string{"--mqtt-profile=azure-event-grid", "--mqtt-profile-host=example.westeurope-1.ts.eventgrid.azure.net", "--mqtt-client-id=client-1", "--mqtt-username=auth-name"}, tlsArgs...),
+			expectedBrokers:  []string{"ssl://example.westeurope-1.ts.eventgrid.azure.net:8883"},
+			expectedUsername: "auth-name",
+		},
+		{
+			testDescription:     "Azure Event Grid without client certificate",
+			args:                []string{"--mqtt-profile=azure-event-grid", "--mqtt-profile-host=example.westeurope-1.ts.eventgrid.azure.net"},
+			expectedErrContains: "mqtt profile azure-event-grid requires a TLS client certificate",
+		},
+		{
+			testDescription: "AWS IoT Core",
+			args:            append([]string{"--mqtt-profile=aws-iot-core", "--mqtt-profile-host=example-ats.iot.eu-west-1.amazonaws.com", "--mqtt-client-id=thing-1"}, tlsArgs...),
+			expectedBrokers: []string{"ssl://example-ats.iot.eu-west-1.amazonaws.com:443"},
+			expectedALPN:    []string{"x-amzn-mqtt-ca"},
+		},
+		{
+			testDescription:     "AWS IoT Core with broker addresses",
+			args:                append([]string{"--mqtt-profile=aws-iot-core", "--mqtt-profile-host=example-ats.iot.eu-west-1.amazonaws.com", "--mqtt-broker-addresses=localhost"}, tlsArgs...),
+			expectedErrContains: "mqtt profile aws-iot-core can't be used with mqtt-broker-addresses",
+		},
+		{
+			testDescription:     "profile host with scheme",
+			args:                append([]string{"--mqtt-profile=aws-iot-core", "--mqtt-profile-host=ssl://example-ats.iot.eu-west-1.amazonaws.com"}, tlsArgs...),
+			expectedErrContains: "mqtt profile aws-iot-core requires a profile host name (without scheme and port)",
+		},
+		{
+			testDescription:     "unknown profile",
+			args:                []string{"--mqtt-profile=fake", "--mqtt-profile-host=example.com"},
+			expectedErrContains: "mqtt profile allowed to be azure-iot-hub, azure-event-grid, aws-iot-core, received: fake",
+		},
+		{
+			testDescription:     "profile host without profile",
+			args:                []string{"--mqtt-broker-addresses=localhost", "--mqtt-profile-host=example.com"},
+			expectedErrContains: "mqtt profile host and Azure shared access key require an mqtt profile",
+		},
+		{
+			testDescription:     "client certificate without key",
+			args:                []string{"--mqtt-broker-addresses=localhost", "--mqtt-tls-cert-file", certFile},
+			expectedErrContains: "both mqtt TLS cert file and key file are required to use a client certificate",
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		client := newClient(Options{
+			DisableExitOnHelp: true,
+		})
+		client.setIO(&bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{})
+
+		args := append([]string{"fake-bin", "--mqtt-topic=fake"}, c.args...)
+		cfg, err := client.generateConfig(args)
+		if c.expectedErrContains != "" {
+			if err == nil || !strings.Contains(err.Error(), c.expectedErrContains) {
+				t.Errorf("Expected err to contain '%s' but was: %v", c.expectedErrContains, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Expected err to be nil: %q", err)
+			continue
+		}
+
+		if !reflect.DeepEqual(cfg.BrokerAddresses, c.expectedBrokers) {
+			t.Errorf("Expected cfg.BrokerAddresses to be '%v' but was: %v", c.expectedBrokers, cfg.BrokerAddresses)
+		}
+
+		if cfg.Username != c.expectedUsername {
+			t.Errorf("Expected cfg.Username to be '%s' but was: %s", c.expectedUsername, cfg.Username)
+		}
+
+		if !reflect.DeepEqual(cfg.TLSALPNProtocols, c.expectedALPN) {
+			t.Errorf("Expected cfg.TLSALPNProtocols to be '%v' but was: %v", c.expectedALPN, cfg.TLSALPNProtocols)
+		}
+	}
+}
+
+func testWriteKeyPair(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	return certFile, keyFile
+}
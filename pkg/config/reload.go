@@ -0,0 +1,83 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"time"
+)
+
+// Reload generates the config again from the same flags, the current env vars and config file.
+// The Client ID is kept, since it would change on every reload with a random suffix.
+func (client *Client) Reload() (Client, error) {
+	reloadClient := newClient(Options{
+		Version:           client.version,
+		Revision:          client.revision,
+		Created:           client.created,
+		DisableExitOnHelp: client.disableExitOnHelp,
+	})
+	reloadClient.setIO(client.cliReader, client.cliWriter, client.cliErrWriter)
+
+	cfg, err := reloadClient.generateConfig(client.args)
+	if err != nil {
+		return NullClient, err
+	}
+
+	cfg.ClientID = client.ClientID
+
+	return cfg, nil
+}
+
+// Changes returns the names of the fields that differ between the configs
+func Changes(oldCfg Client, newCfg Client) []string {
+	var changes []string
+
+	oldValue := reflect.ValueOf(oldCfg)
+	newValue := reflect.ValueOf(newCfg)
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			changes = append(changes, field.Name)
+		}
+	}
+
+	return changes
+}
+
+// WatchFile calls onChange when the modification time or size of the file changes, until ctx is done.
+// The file is checked every interval, which also works for config maps mounted in Kubernetes (where the file is replaced using a symlink).
+func WatchFile(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	lastModTime, lastSize, _ := fileModTimeAndSize(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTime, size, ok := fileModTimeAndSize(path)
+			if !ok || (modTime.Equal(lastModTime) && size == lastSize) {
+				continue
+			}
+
+			lastModTime, lastSize = modTime, size
+			onChange()
+		}
+	}
+}
+
+// fileModTimeAndSize returns false if the file can't be accessed, like when it is being replaced
+func fileModTimeAndSize(path string) (time.Time, int64, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+
+	return info.ModTime(), info.Size(), true
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	envVarsToClear := []string{
+		"MQTT_BROKER_ADDRESSES",
+		"MQTT_HOST_1",
+		"MQTT_HOST_2",
+		"MQTT_HOST_3",
+		"MQTT_TOPIC",
+		"LOG_TOPIC",
+		"MQTT_QOS",
+		"LOG_LEVEL",
+		"CONFIG_FILE",
+		"CONFIG_WATCH_INTERVAL",
+	}
+
+	for _, envVar := range envVarsToClear {
+		restore := tempUnsetEnv(envVar)
+		defer restore()
+	}
+
+	filePath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(filePath, []byte("mqtt-topic: test/#\nlog-level: info\n"), 0600)
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	client := newClient(Options{
+		DisableExitOnHelp: true,
+	})
+	client.setIO(&bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{})
+	cfg, err := client.generateConfig([]string{"fake-bin", "--config", filePath, "--mqtt-broker-addresses=localhost", "--mqtt-client-id-random-suffix"})
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	err = os.WriteFile(filePath, []byte("mqtt-topic: reloaded/#\nmqtt-qos: 1\nlog-level: debug\n"), 0600)
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	reloadedCfg, err := cfg.Reload()
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	if reloadedCfg.ClientID != cfg.ClientID {
+		t.Errorf("Expected the client ID to be kept as '%s' but was: %s", cfg.ClientID, reloadedCfg.ClientID)
+	}
+
+	expectedChanges := []string{"Topic", "QoS", "LogLevel"}
+	changes := Changes(cfg, reloadedCfg)
+	if !reflect.DeepEqual(changes, expectedChanges) {
+		t.Errorf("Expected changes to be '%v' but was: %v", expectedChanges, changes)
+	}
+
+	// Reloading again uses the flags from the start and the latest file
+	reloadedAgainCfg, err := reloadedCfg.Reload()
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	changes = Changes(reloadedCfg, reloadedAgainCfg)
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes but was: %v", changes)
+	}
+
+	err = os.WriteFile(filePath, []byte("mqtt-topic: reloaded/#\nmqtt-qos: 3\n"), 0600)
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	_, err = cfg.Reload()
+	if err == nil || !strings.Contains(err.Error(), "key \"mqtt-qos\": QoS allowed to be 0, 1 or 2, received: 3") {
+		t.Errorf("Expected err to be an invalid QoS error but was: %v", err)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	oldCfg := Client{
+		BrokerAddresses:    []string{"tcp://localhost:1883"},
+		Topic:              "fake-topic",
+		MetricsConstLabels: map[string]string{"env": "dev"},
+		version:            "v1",
+	}
+
+	cases := []struct {
+		testDescription string
+		newCfg          Client
+		expectedChanges []string
+	}{
+		{
+			testDescription: "no changes",
+			newCfg: Client{
+				BrokerAddresses:    []string{"tcp://localhost:1883"},
+				Topic:              "fake-topic",
+				MetricsConstLabels: map[string]string{"env": "dev"},
+				version:            "v2",
+			},
+			expectedChanges: nil,
+		},
+		{
+			testDescription: "changed slices, maps and values",
+			newCfg: Client{
+				BrokerAddresses:    []string{"tcp://localhost:1883", "tcp://localhost:1884"},
+				Topic:              "fake-topic",
+				MetricsConstLabels: map[string]string{"env": "prod"},
+				LogLevel:           "debug",
+			},
+			expectedChanges: []string{"BrokerAddresses", "MetricsConstLabels", "LogLevel"},
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		changes := Changes(oldCfg, c.newCfg)
+		if !reflect.DeepEqual(changes, c.expectedChanges) {
+			t.Errorf("Expected changes to be '%v' but was: %v", c.expectedChanges, changes)
+		}
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(filePath, []byte("mqtt-topic: test/#\n"), 0600)
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	var changes atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		WatchFile(ctx, filePath, 10*time.Millisecond, func() { changes.Add(1) })
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if changes.Load() != 0 {
+		t.Errorf("Expected no changes before the file is changed but was: %d", changes.Load())
+	}
+
+	err = os.WriteFile(filePath, []byte("mqtt-topic: changed/#\n"), 0600)
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		if changes.Load() == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if changes.Load() != 1 {
+		t.Errorf("Expected one change but was: %d", changes.Load())
+	}
+
+	// A removed file isn't reported as a change
+	err = os.Remove(filePath)
+	if err != nil {
+		t.Fatalf("Expected err to be nil: %q", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if changes.Load() != 1 {
+		t.Errorf("Expected a removed file not to be a change but was: %d", changes.Load())
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,137 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Resolver is implemented by net.Resolver and used to look up the brokers
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Options takes the input configuration for the broker discovery, either SRVRecord or Host is used
+type Options struct {
+	// SRVRecord is resolved to the brokers (like _mqtt._tcp.example.com), using the port from the records
+	SRVRecord string
+	// Host is resolved to all its A and AAAA records (like a Kubernetes headless service), using Port
+	Host string
+	Port int
+	// Scheme is used for the discovered broker URLs, tcp is used if empty
+	Scheme string
+	// Resolver is used to look up the brokers, net.DefaultResolver is used if nil
+	Resolver Resolver
+}
+
+// Client discovers the mqtt brokers using DNS
+type Client struct {
+	srvRecord string
+	host      string
+	port      int
+	scheme    string
+	resolver  Resolver
+}
+
+// NewClient returns a broker discovery client
+func NewClient(opts Options) *Client {
+	scheme := opts.Scheme
+	if scheme == "" {
+		scheme = "tcp"
+	}
+
+	var resolver Resolver = net.DefaultResolver
+	if opts.Resolver != nil {
+		resolver = opts.Resolver
+	}
+
+	return &Client{
+		srvRecord: opts.SRVRecord,
+		host:      opts.Host,
+		port:      opts.Port,
+		scheme:    scheme,
+		resolver:  resolver,
+	}
+}
+
+// Name returns the DNS name used to discover the brokers
+func (client *Client) Name() string {
+	if client.srvRecord != "" {
+		return client.srvRecord
+	}
+
+	return client.host
+}
+
+// Discover returns the broker URLs in the order returned by the resolver, which spreads the clients over the brokers.
+// The net.Resolver orders SRV records by priority and randomizes the ones with the same priority by weight,
+// A and AAAA records are usually rotated by the DNS server. The order changes between lookups, sort a copy to compare them.
+func (client *Client) Discover(ctx context.Context) ([]string, error) {
+	if client.srvRecord != "" {
+		return client.discoverSRV(ctx)
+	}
+
+	return client.discoverHost(ctx)
+}
+
+func (client *Client) discoverSRV(ctx context.Context) ([]string, error) {
+	// The record is looked up as is when service and proto are empty
+	_, records, err := client.resolver.LookupSRV(ctx, "", "", client.srvRecord)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up SRV record %q: %w", client.srvRecord, err)
+	}
+
+	var brokers []string
+	for _, record := range records {
+		target := strings.TrimSuffix(record.Target, ".")
+		// A single "." target means that the service isn't available
+		if target == "" {
+			continue
+		}
+
+		brokers = append(brokers, client.brokerURL(target, int(record.Port)))
+	}
+
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("SRV record %q doesn't have any targets", client.srvRecord)
+	}
+
+	return brokers, nil
+}
+
+func (client *Client) discoverHost(ctx context.Context) ([]string, error) {
+	addresses, err := client.resolver.LookupIPAddr(ctx, client.host)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up host %q: %w", client.host, err)
+	}
+
+	ips := make([]string, 0, len(addresses))
+	seen := make(map[string]bool)
+	for _, address := range addresses {
+		ip := address.String()
+		if seen[ip] {
+			continue
+		}
+
+		seen[ip] = true
+		ips = append(ips, ip)
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("host %q doesn't have any addresses", client.host)
+	}
+
+	brokers := make([]string, len(ips))
+	for i, ip := range ips {
+		brokers[i] = client.brokerURL(ip, client.port)
+	}
+
+	return brokers, nil
+}
+
+func (client *Client) brokerURL(host string, port int) string {
+	return fmt.Sprintf("%s://%s", client.scheme, net.JoinHostPort(host, strconv.Itoa(port)))
+}
@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResolver struct {
+	srvRecords map[string][]*net.SRV
+	addresses  map[string][]net.IPAddr
+}
+
+func (resolver *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	records, ok := resolver.srvRecords[name]
+	if !ok {
+		return "", nil, fmt.Errorf("fake no such host")
+	}
+
+	return name, records, nil
+}
+
+func (resolver *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addresses, ok := resolver.addresses[host]
+	if !ok {
+		return nil, fmt.Errorf("fake no such host")
+	}
+
+	return addresses, nil
+}
+
+func TestDiscover(t *testing.T) {
+	resolver := &fakeResolver{
+		srvRecords: map[string][]*net.SRV{
+			"_mqtt._tcp.example.com": {
+				{Target: "backup.example.com.", Port: 1883, Priority: 20, Weight: 100},
+				{Target: "broker-b.example.com.", Port: 1883, Priority: 10, Weight: 10},
+				{Target: "broker-a.example.com.", Port: 1884, Priority: 10, Weight: 50},
+			},
+			"_mqtt._tcp.unavailable.example.com": {
+				{Target: ".", Port: 0},
+			},
+		},
+		addresses: map[string][]net.IPAddr{
+			"broker-headless.default.svc.cluster.local": {
+				{IP: net.ParseIP("10.0.0.12")},
+				{IP: net.ParseIP("fd00::1")},
+				{IP: net.ParseIP("10.0.0.11")},
+				{IP: net.ParseIP("10.0.0.11")},
+			},
+			"empty.example.com": {},
+		},
+	}
+
+	cases := []struct {
+		testDescription string
+		opts            Options
+		expectedBrokers []string
+		expectedErr     string
+	}{
+		{
+			testDescription: "SRV record in the resolver order",
+			opts:            Options{SRVRecord: "_mqtt._tcp.example.com"},
+			expectedBrokers: []string{"tcp://backup.example.com:1883", "tcp://broker-b.example.com:1883", "tcp://broker-a.example.com:1884"},
+		},
+		{
+			testDescription: "SRV record with scheme",
+			opts:            Options{SRVRecord: "_mqtt._tcp.example.com", Scheme: "ssl"},
+			expectedBrokers: []string{"ssl://backup.example.com:1883", "ssl://broker-b.example.com:1883", "ssl://broker-a.example.com:1884"},
+		},
+		{
+			testDescription: "SRV record without targets",
+			opts:            Options{SRVRecord: "_mqtt._tcp.unavailable.example.com"},
+			expectedErr:     "SRV record \"_mqtt._tcp.unavailable.example.com\" doesn't have any targets",
+		},
+		{
+			testDescription: "SRV record not found",
+			opts:            Options{SRVRecord: "_mqtt._tcp.missing.example.com"},
+			expectedErr:     "unable to look up SRV record \"_mqtt._tcp.missing.example.com\": fake no such host",
+		},
+		{
+			testDescription: "headless service with IPv4 and IPv6 addresses",
+			opts:            Options{Host: "broker-headless.default.svc.cluster.local", Port: 1883},
+			expectedBrokers: []string{"tcp://10.0.0.12:1883", "tcp://[fd00::1]:1883", "tcp://10.0.0.11:1883"},
+		},
+		{
+			testDescription: "host without addresses",
+			opts:            Options{Host: "empty.example.com", Port: 1883},
+			expectedErr:     "host \"empty.example.com\" doesn't have any addresses",
+		},
+		{
+			testDescription: "host not found",
+			opts:            Options{Host: "missing.example.com", Port: 1883},
+			expectedErr:     "unable to look up host \"missing.example.com\": fake no such host",
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		c.opts.Resolver = resolver
+		brokers, err := NewClient(c.opts).Discover(context.Background())
+		if c.expectedErr != "" {
+			require.EqualError(t, err, c.expectedErr)
+			continue
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, c.expectedBrokers, brokers)
+	}
+}
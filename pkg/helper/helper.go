@@ -31,17 +31,27 @@ func NewShutdownTimeoutContext() (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), 2*time.Second)
 }
 
-func WaitForStop(stopChan chan os.Signal, ctx context.Context) string {
-	select {
-	case sig := <-stopChan:
-		return fmt.Sprintf("os.Signal (%s)", sig)
-	case <-ctx.Done():
-		return "context"
+// WaitForStop waits for a stop signal or for ctx to be done and returns what initiated the stop.
+// SIGHUP calls reload and continues waiting, or stops if reload is nil.
+func WaitForStop(stopChan chan os.Signal, ctx context.Context, reload func()) string {
+	for {
+		select {
+		case sig := <-stopChan:
+			if sig == syscall.SIGHUP && reload != nil {
+				reload()
+				continue
+			}
+
+			return fmt.Sprintf("os.Signal (%s)", sig)
+		case <-ctx.Done():
+			return "context"
+		}
 	}
 }
 
+// NewStopChannel returns a channel receiving the stop signals and SIGHUP, which is used to reload (see WaitForStop)
 func NewStopChannel() chan os.Signal {
 	stopChan := make(chan os.Signal, 2)
-	signal.Notify(stopChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGPIPE)
+	signal.Notify(stopChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGPIPE, syscall.SIGHUP)
 	return stopChan
 }
@@ -0,0 +1,43 @@
+package helper
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadSecretFile returns the content of a secret file without the trailing newline, which is often added by editors and echo
+func ReadSecretFile(path string) (string, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret file %q: %w", path, err)
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// Redacted replaces secrets in status messages and debug state reports
+const Redacted = "redacted"
+
+// RedactURL returns the URL with the password replaced (see url.URL.Redacted), to be able to log it.
+// The URL is fully redacted if it can't be parsed.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Redacted
+	}
+
+	return u.Redacted()
+}
+
+// RedactURLs returns the URLs with the passwords replaced, see RedactURL()
+func RedactURLs(rawURLs []string) []string {
+	redacted := make([]string, len(rawURLs))
+	for i, rawURL := range rawURLs {
+		redacted[i] = RedactURL(rawURL)
+	}
+
+	return redacted
+}
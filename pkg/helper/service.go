@@ -2,6 +2,7 @@ package helper
 
 import (
 	"context"
+	"errors"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -14,6 +15,41 @@ type ServiceStopper interface {
 	Stop(ctx context.Context) error
 }
 
+// ServiceHealthChecker is implemented by services (or components) that can report their health
+type ServiceHealthChecker interface {
+	// HealthName returns the name of the component in health reports
+	HealthName() string
+	// Health returns nil if the component is healthy or an error describing why it isn't
+	Health() error
+}
+
+// ServiceDebugStateReporter is implemented by services (or components) that can report their internal state for debugging
+type ServiceDebugStateReporter interface {
+	// DebugStateName returns the name of the component in debug state reports
+	DebugStateName() string
+	// DebugState returns the internal state, it needs to be possible to encode as JSON and can't contain secrets
+	DebugState() interface{}
+}
+
+var (
+	// ErrSubscriptionNotFound is returned by ServiceSubscriptionManager when removing a subscription that doesn't exist
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	// ErrInvalidSubscription is returned by ServiceSubscriptionManager when the topic filter or QoS isn't valid
+	ErrInvalidSubscription = errors.New("invalid subscription")
+)
+
+// ServiceSubscriptionManager is implemented by services that can change their subscriptions at runtime
+type ServiceSubscriptionManager interface {
+	// Subscriptions returns the topic filters and their requested QoS
+	Subscriptions() map[string]int
+	AddSubscription(topic string, qos int) error
+	RemoveSubscription(topic string) error
+	// Pause stops printing messages until Resume is called
+	Pause()
+	Resume()
+	Paused() bool
+}
+
 func StartService(ctx context.Context, g *errgroup.Group, s ServiceStarter) {
 	g.Go(func() error {
 		return s.Start(ctx)
@@ -0,0 +1,35 @@
+package message
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// envelope is the JSON output of a message with its metadata
+type envelope struct {
+	Topic    string          `json:"topic"`
+	Retained bool            `json:"retained"`
+	Received string          `json:"received"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// Envelope returns the message wrapped in a JSON envelope with the topic, retained flag and received timestamp.
+// The payload is included as JSON if valid and as a string otherwise.
+func Envelope(topic string, payload []byte, retained bool, received time.Time) string {
+	rawPayload := json.RawMessage(payload)
+	if !json.Valid(payload) {
+		// A string can't fail to marshal
+		rawPayload, _ = json.Marshal(string(payload))
+	}
+
+	e := envelope{
+		Topic:    topic,
+		Retained: retained,
+		Received: received.UTC().Format(time.RFC3339Nano),
+		Payload:  rawPayload,
+	}
+
+	// The envelope only contains strings, a bool and valid JSON, which can't fail to marshal
+	b, _ := json.Marshal(e)
+	return string(b)
+}
@@ -1,15 +1,24 @@
 package message
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+)
 
 // Options takes the input configuration for the message client
 type Options struct{}
 
-type client struct{}
+type client struct {
+	lastErr   error
+	lastErrMu sync.RWMutex
+}
 
 // Client interface
 type Client interface {
-	Print(m string)
+	Print(m string) error
+	h.ServiceHealthChecker
 }
 
 // NewClient returns a Client interface
@@ -17,7 +26,27 @@ func NewClient(opts Options) Client {
 	return &client{}
 }
 
-// Print takes a string and prints it to stdout
-func (client *client) Print(m string) {
-	fmt.Println(m)
+// Print takes a string and prints it to stdout, returning an error if the write failed
+func (client *client) Print(m string) error {
+	_, err := fmt.Println(m)
+	client.setLastErr(err)
+	return err
+}
+
+// HealthName returns the name of the message client in health reports
+func (client *client) HealthName() string {
+	return "message"
+}
+
+// Health returns the error of the last write, if it failed
+func (client *client) Health() error {
+	client.lastErrMu.RLock()
+	defer client.lastErrMu.RUnlock()
+	return client.lastErr
+}
+
+func (client *client) setLastErr(err error) {
+	client.lastErrMu.Lock()
+	client.lastErr = err
+	client.lastErrMu.Unlock()
 }
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestPrint(t *testing.T) {
@@ -20,7 +21,10 @@ func TestPrint(t *testing.T) {
 	}
 
 	os.Stdout = w
-	messageClient.Print("fake message")
+	err = messageClient.Print("fake message")
+	if err != nil {
+		t.Errorf("Expected err to be nil: %q", err)
+	}
 	w.Close()
 
 	outputBytes, err := io.ReadAll(r)
@@ -30,7 +34,48 @@ func TestPrint(t *testing.T) {
 
 	output := string(outputBytes)
 
+	if messageClient.Health() != nil {
+		t.Errorf("Expected health to be nil: %q", messageClient.Health())
+	}
+
 	if output != "fake message\n" {
 		t.Errorf("Expected output to be '\"fake message\":' but was: %q", output)
 	}
 }
+
+func TestEnvelope(t *testing.T) {
+	received := time.Date(2023, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	cases := []struct {
+		testDescription string
+		payload         []byte
+		retained        bool
+		expectedOutput  string
+	}{
+		{
+			testDescription: "JSON payload",
+			payload:         []byte(`{"level":"info","msg":"fake"}`),
+			expectedOutput:  `{"topic":"fake/topic","retained":false,"received":"2023-01-02T03:04:05.000000006Z","payload":{"level":"info","msg":"fake"}}`,
+		},
+		{
+			testDescription: "text payload of a retained message",
+			payload:         []byte("fake \"message\""),
+			retained:        true,
+			expectedOutput:  `{"topic":"fake/topic","retained":true,"received":"2023-01-02T03:04:05.000000006Z","payload":"fake \"message\""}`,
+		},
+		{
+			testDescription: "empty payload",
+			payload:         []byte{},
+			expectedOutput:  `{"topic":"fake/topic","retained":false,"received":"2023-01-02T03:04:05.000000006Z","payload":""}`,
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		output := Envelope("fake/topic", c.payload, c.retained, received)
+		if output != c.expectedOutput {
+			t.Errorf("Expected output to be '%s' but was: %s", c.expectedOutput, output)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+)
+
+type adminSubscription struct {
+	Topic string `json:"topic"`
+	QoS   int    `json:"qos"`
+}
+
+type adminResponse struct {
+	Paused        bool                `json:"paused"`
+	Subscriptions []adminSubscription `json:"subscriptions"`
+}
+
+type adminErrorResponse struct {
+	ErrorMessage string `json:"error"`
+}
+
+// addAdminRoutes adds the admin API to manage subscriptions and pause/resume printing messages at runtime
+func (server *Server) addAdminRoutes(router *mux.Router) {
+	router.HandleFunc("/admin/subscriptions", server.listSubscriptionsHandler).Methods(http.MethodGet)
+	router.HandleFunc("/admin/subscriptions", server.addSubscriptionHandler).Methods(http.MethodPost)
+	// The topic is a query parameter since topic filters contain '/', '+' and '#'
+	router.HandleFunc("/admin/subscriptions", server.removeSubscriptionHandler).Methods(http.MethodDelete)
+	router.HandleFunc("/admin/pause", server.pauseHandler).Methods(http.MethodPost)
+	router.HandleFunc("/admin/resume", server.resumeHandler).Methods(http.MethodPost)
+}
+
+func (server *Server) listSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	server.writeAdminResponse(w, http.StatusOK)
+}
+
+func (server *Server) addSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	var subscription adminSubscription
+	err := json.NewDecoder(r.Body).Decode(&subscription)
+	if err != nil {
+		server.writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = server.subscriptionManager.AddSubscription(subscription.Topic, subscription.QoS)
+	if err != nil {
+		server.writeAdminError(w, adminErrorStatusCode(err), err)
+		return
+	}
+
+	server.writeAdminResponse(w, http.StatusCreated)
+}
+
+func (server *Server) removeSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	err := server.subscriptionManager.RemoveSubscription(r.URL.Query().Get("topic"))
+	if err != nil {
+		server.writeAdminError(w, adminErrorStatusCode(err), err)
+		return
+	}
+
+	server.writeAdminResponse(w, http.StatusOK)
+}
+
+func (server *Server) pauseHandler(w http.ResponseWriter, r *http.Request) {
+	server.subscriptionManager.Pause()
+	server.writeAdminResponse(w, http.StatusOK)
+}
+
+func (server *Server) resumeHandler(w http.ResponseWriter, r *http.Request) {
+	server.subscriptionManager.Resume()
+	server.writeAdminResponse(w, http.StatusOK)
+}
+
+func adminErrorStatusCode(err error) int {
+	switch {
+	case errors.Is(err, h.ErrInvalidSubscription):
+		return http.StatusBadRequest
+	case errors.Is(err, h.ErrSubscriptionNotFound):
+		return http.StatusNotFound
+	default:
+		// The broker didn't accept the change
+		return http.StatusBadGateway
+	}
+}
+
+// writeAdminResponse writes the current subscriptions (sorted by topic) and if printing messages is paused
+func (server *Server) writeAdminResponse(w http.ResponseWriter, statusCode int) {
+	res := adminResponse{
+		Paused:        server.subscriptionManager.Paused(),
+		Subscriptions: []adminSubscription{},
+	}
+
+	for topic, qos := range server.subscriptionManager.Subscriptions() {
+		res.Subscriptions = append(res.Subscriptions, adminSubscription{Topic: topic, QoS: qos})
+	}
+
+	sort.Slice(res.Subscriptions, func(i, j int) bool {
+		return res.Subscriptions[i].Topic < res.Subscriptions[j].Topic
+	})
+
+	server.writeAdminJSON(w, statusCode, res)
+}
+
+func (server *Server) writeAdminError(w http.ResponseWriter, statusCode int, err error) {
+	server.writeAdminJSON(w, statusCode, adminErrorResponse{ErrorMessage: err.Error()})
+}
+
+func (server *Server) writeAdminJSON(w http.ResponseWriter, statusCode int, res interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	err := json.NewEncoder(w).Encode(res)
+	if err != nil {
+		server.statusClient.Warn("Unable to write admin response", "error", err)
+	}
+}
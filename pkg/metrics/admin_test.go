@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+)
+
+func TestAdminHandlers(t *testing.T) {
+	cases := []struct {
+		testDescription string
+		method          string
+		path            string
+		body            string
+		subscribeErr    error
+		expectedCode    int
+		expectedBody    string
+	}{
+		{
+			testDescription: "List subscriptions",
+			method:          http.MethodGet,
+			path:            "/admin/subscriptions",
+			expectedCode:    http.StatusOK,
+			expectedBody:    `{"paused":false,"subscriptions":[{"topic":"fake-topic","qos":1}]}`,
+		},
+		{
+			testDescription: "Add subscription",
+			method:          http.MethodPost,
+			path:            "/admin/subscriptions",
+			body:            `{"topic":"devices/+/logs","qos":0}`,
+			expectedCode:    http.StatusCreated,
+			expectedBody:    `{"paused":false,"subscriptions":[{"topic":"devices/+/logs","qos":0},{"topic":"fake-topic","qos":1}]}`,
+		},
+		{
+			testDescription: "Add subscription with invalid body",
+			method:          http.MethodPost,
+			path:            "/admin/subscriptions",
+			body:            `fake`,
+			expectedCode:    http.StatusBadRequest,
+		},
+		{
+			testDescription: "Add invalid subscription",
+			method:          http.MethodPost,
+			path:            "/admin/subscriptions",
+			body:            `{"topic":"fake-topic-2","qos":0}`,
+			subscribeErr:    fmt.Errorf("%w: fake error", h.ErrInvalidSubscription),
+			expectedCode:    http.StatusBadRequest,
+			expectedBody:    `{"error":"invalid subscription: fake error"}`,
+		},
+		{
+			testDescription: "Add subscription not allowed by the broker",
+			method:          http.MethodPost,
+			path:            "/admin/subscriptions",
+			body:            `{"topic":"fake-topic-2","qos":0}`,
+			subscribeErr:    fmt.Errorf("subscription not allowed"),
+			expectedCode:    http.StatusBadGateway,
+		},
+		{
+			testDescription: "Remove subscription",
+			method:          http.MethodDelete,
+			path:            "/admin/subscriptions?topic=fake-topic",
+			expectedCode:    http.StatusOK,
+			expectedBody:    `{"paused":false,"subscriptions":[]}`,
+		},
+		{
+			testDescription: "Remove subscription that doesn't exist",
+			method:          http.MethodDelete,
+			path:            "/admin/subscriptions?topic=fake-topic-2",
+			expectedCode:    http.StatusNotFound,
+		},
+		{
+			testDescription: "Pause",
+			method:          http.MethodPost,
+			path:            "/admin/pause",
+			expectedCode:    http.StatusOK,
+			expectedBody:    `{"paused":true,"subscriptions":[{"topic":"fake-topic","qos":1}]}`,
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		subscriptionManager := &testFakeSubscriptionManager{
+			subscriptions: map[string]int{"fake-topic": 1},
+			err:           c.subscribeErr,
+		}
+
+		metricsServer := NewServer(Options{
+			StatusClient:        testNewFakeStatusClient(t),
+			SubscriptionManager: subscriptionManager,
+		})
+
+		res := httptest.NewRecorder()
+		metricsServer.httpServer.Handler.ServeHTTP(res, httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)))
+		require.Equal(t, c.expectedCode, res.Code)
+		require.Equal(t, "application/json", res.Header().Get("Content-Type"))
+		if c.expectedBody != "" {
+			require.JSONEq(t, c.expectedBody, res.Body.String())
+		}
+	}
+
+	// The admin API isn't exposed without a subscription manager
+	metricsServer := NewServer(Options{
+		StatusClient: testNewFakeStatusClient(t),
+	})
+
+	res := httptest.NewRecorder()
+	metricsServer.httpServer.Handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/admin/subscriptions", nil))
+	require.Equal(t, http.StatusNotFound, res.Code)
+}
+
+type testFakeSubscriptionManager struct {
+	subscriptions map[string]int
+	paused        bool
+	err           error
+}
+
+func (manager *testFakeSubscriptionManager) Subscriptions() map[string]int {
+	return manager.subscriptions
+}
+
+func (manager *testFakeSubscriptionManager) AddSubscription(topic string, qos int) error {
+	if manager.err != nil {
+		return manager.err
+	}
+
+	manager.subscriptions[topic] = qos
+	return nil
+}
+
+func (manager *testFakeSubscriptionManager) RemoveSubscription(topic string) error {
+	_, found := manager.subscriptions[topic]
+	if !found {
+		return h.ErrSubscriptionNotFound
+	}
+
+	delete(manager.subscriptions, topic)
+	return nil
+}
+
+func (manager *testFakeSubscriptionManager) Pause() {
+	manager.paused = true
+}
+
+func (manager *testFakeSubscriptionManager) Resume() {
+	manager.paused = false
+}
+
+func (manager *testFakeSubscriptionManager) Paused() bool {
+	return manager.paused
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+	"github.com/xenitab/mqtt-log-stdout/pkg/status"
+)
+
+// unauthenticatedPaths are used by probes and don't require authentication
+var unauthenticatedPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+type authOptions struct {
+	basicAuthUsername string
+	basicAuthPassword *secret
+	bearerToken       *secret
+	requireClientCert bool
+}
+
+func (opts authOptions) enabled() bool {
+	return opts.basicAuthUsername != "" || opts.bearerToken.configured() || opts.requireClientCert
+}
+
+// secret is a static value or the content of a file, read again when the file is changed (for example a rotated Kubernetes secret)
+type secret struct {
+	value        string
+	file         string
+	modTime      time.Time
+	statusClient status.Client
+	mu           sync.Mutex
+}
+
+func newSecret(value string, file string, statusClient status.Client) *secret {
+	return &secret{
+		value:        value,
+		file:         file,
+		statusClient: statusClient,
+	}
+}
+
+func (s *secret) configured() bool {
+	return s != nil && (s.value != "" || s.file != "")
+}
+
+// get returns the secret, the previous value is kept if the file can't be read
+func (s *secret) get() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == "" {
+		return s.value
+	}
+
+	info, err := os.Stat(s.file)
+	if err != nil || info.ModTime().Equal(s.modTime) {
+		return s.value
+	}
+
+	value, err := h.ReadSecretFile(s.file)
+	if err != nil {
+		s.statusClient.Warn("Unable to read metrics server secret file, using the previous value", "file", s.file, "error", err)
+		return s.value
+	}
+
+	s.value = value
+	s.modTime = info.ModTime()
+
+	return s.value
+}
+
+// authMiddleware requires a verified client certificate, basic auth or bearer token (depending on the configuration) for all paths except unauthenticatedPaths
+func (server *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unauthenticatedPaths[r.URL.Path] || server.authenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch {
+		case server.auth.basicAuthUsername != "":
+			w.Header().Set("WWW-Authenticate", `Basic realm="mqtt-log-stdout"`)
+		case server.auth.bearerToken.configured():
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mqtt-log-stdout"`)
+		}
+
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+func (server *Server) authenticated(r *http.Request) bool {
+	if server.auth.requireClientCert && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		return false
+	}
+
+	if server.auth.basicAuthUsername != "" {
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return false
+		}
+
+		usernameMatch := secureCompare(username, server.auth.basicAuthUsername)
+		passwordMatch := secureCompare(password, server.auth.basicAuthPassword.get())
+
+		return usernameMatch && passwordMatch
+	}
+
+	if server.auth.bearerToken.configured() {
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			return false
+		}
+
+		return secureCompare(strings.TrimPrefix(authorization, "Bearer "), server.auth.bearerToken.get())
+	}
+
+	return true
+}
+
+// secureCompare never matches an empty expected value, which can happen when a secret file is empty or can't be read
+func secureCompare(given string, expected string) bool {
+	if expected == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
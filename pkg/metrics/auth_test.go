@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	cases := []struct {
+		testDescription string
+		opts            Options
+		path            string
+		setAuth         func(r *http.Request)
+		expectedCode    int
+	}{
+		{
+			testDescription: "No authentication configured",
+			opts:            Options{},
+			path:            "/metrics",
+			setAuth:         func(r *http.Request) {},
+			expectedCode:    http.StatusOK,
+		},
+		{
+			testDescription: "Basic auth missing",
+			opts:            Options{BasicAuthUsername: "user", BasicAuthPassword: "pass"},
+			path:            "/metrics",
+			setAuth:         func(r *http.Request) {},
+			expectedCode:    http.StatusUnauthorized,
+		},
+		{
+			testDescription: "Basic auth wrong password",
+			opts:            Options{BasicAuthUsername: "user", BasicAuthPassword: "pass"},
+			path:            "/metrics",
+			setAuth:         func(r *http.Request) { r.SetBasicAuth("user", "wrong") },
+			expectedCode:    http.StatusUnauthorized,
+		},
+		{
+			testDescription: "Basic auth correct",
+			opts:            Options{BasicAuthUsername: "user", BasicAuthPassword: "pass"},
+			path:            "/metrics",
+			setAuth:         func(r *http.Request) { r.SetBasicAuth("user", "pass") },
+			expectedCode:    http.StatusOK,
+		},
+		{
+			testDescription: "Bearer token wrong",
+			opts:            Options{BearerToken: "token"},
+			path:            "/metrics",
+			setAuth:         func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") },
+			expectedCode:    http.StatusUnauthorized,
+		},
+		{
+			testDescription: "Bearer token correct",
+			opts:            Options{BearerToken: "token"},
+			path:            "/metrics",
+			setAuth:         func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") },
+			expectedCode:    http.StatusOK,
+		},
+		{
+			testDescription: "Health endpoints don't require authentication",
+			opts:            Options{BearerToken: "token"},
+			path:            "/readyz",
+			setAuth:         func(r *http.Request) {},
+			expectedCode:    http.StatusOK,
+		},
+		{
+			testDescription: "Client certificate missing",
+			opts:            Options{TLSClientCAFile: "fake-ca.pem"},
+			path:            "/metrics",
+			setAuth:         func(r *http.Request) {},
+			expectedCode:    http.StatusUnauthorized,
+		},
+		{
+			testDescription: "Debug endpoints require authentication",
+			opts:            Options{BearerToken: "token", DebugEnabled: true},
+			path:            "/debug/state",
+			setAuth:         func(r *http.Request) {},
+			expectedCode:    http.StatusUnauthorized,
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		c.opts.StatusClient = testNewFakeStatusClient(t)
+		metricsServer := NewServer(c.opts)
+
+		handler := metricsServer.httpServer.Handler
+		if metricsServer.debugServer != nil {
+			handler = metricsServer.debugServer.Handler
+		}
+
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		c.setAuth(req)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		require.Equal(t, c.expectedCode, res.Code)
+	}
+}
+
+func TestAuthSecretFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	err := os.WriteFile(tokenFile, []byte("token\n"), 0600)
+	require.NoError(t, err)
+
+	metricsServer := NewServer(Options{
+		BearerTokenFile: tokenFile,
+		StatusClient:    testNewFakeStatusClient(t),
+	})
+
+	requestWithToken := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		metricsServer.httpServer.Handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	require.Equal(t, http.StatusOK, requestWithToken("token"))
+	require.Equal(t, http.StatusUnauthorized, requestWithToken("rotated-token"))
+
+	// The rotated token is used when the file is changed
+	err = os.WriteFile(tokenFile, []byte("rotated-token\n"), 0600)
+	require.NoError(t, err)
+	err = os.Chtimes(tokenFile, time.Now(), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusUnauthorized, requestWithToken("token"))
+	require.Equal(t, http.StatusOK, requestWithToken("rotated-token"))
+
+	// The previous token is kept when the file can't be read
+	err = os.Remove(tokenFile)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, requestWithToken("rotated-token"))
+
+	// An empty token never matches
+	emptyTokenFile := filepath.Join(t.TempDir(), "empty-token")
+	err = os.WriteFile(emptyTokenFile, []byte("\n"), 0600)
+	require.NoError(t, err)
+
+	metricsServer = NewServer(Options{
+		BearerTokenFile: emptyTokenFile,
+		StatusClient:    testNewFakeStatusClient(t),
+	})
+	require.Equal(t, http.StatusUnauthorized, requestWithToken(""))
+}
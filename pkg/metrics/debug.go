@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gorilla/mux"
+)
+
+// newDebugRouter returns the router for pprof and /debug/state, served separately to not expose it on the metrics port
+func (server *Server) newDebugRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/debug/state", server.debugStateHandler).Methods(http.MethodGet)
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+
+	return router
+}
+
+// debugStateHandler returns the internal state of all components as JSON
+func (server *Server) debugStateHandler(w http.ResponseWriter, r *http.Request) {
+	res := make(map[string]interface{})
+	for _, reporter := range server.debugStateReporters {
+		res[reporter.DebugStateName()] = reporter.DebugState()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(res)
+	if err != nil {
+		server.statusClient.Warn("Unable to write debug state response", "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	healthStatusOK          = "ok"
+	healthStatusUnavailable = "unavailable"
+)
+
+type healthComponent struct {
+	Status         string     `json:"status"`
+	ErrorMessage   string     `json:"error,omitempty"`
+	UnhealthySince *time.Time `json:"unhealthy_since,omitempty"`
+}
+
+type healthResponse struct {
+	Status       string                     `json:"status"`
+	ErrorMessage string                     `json:"error,omitempty"`
+	Components   map[string]healthComponent `json:"components,omitempty"`
+}
+
+// livenessHandler reports that the process is alive, unless a component has been unhealthy for longer than the liveness
+// threshold (like a connection that can't be restored), which makes Kubernetes restart the pod. Components that are
+// unhealthy for a shorter time are only reported by /readyz.
+func (server *Server) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	res := server.checkHealth()
+	res.Status = healthStatusOK
+	res.ErrorMessage = ""
+
+	for name, component := range res.Components {
+		if server.livenessThreshold == 0 || component.UnhealthySince == nil {
+			continue
+		}
+
+		unhealthyFor := time.Since(*component.UnhealthySince)
+		if unhealthyFor > server.livenessThreshold {
+			res.Status = healthStatusUnavailable
+			res.ErrorMessage = fmt.Sprintf("%s unhealthy for %s (threshold: %s)", name, unhealthyFor.Round(time.Second), server.livenessThreshold)
+			break
+		}
+	}
+
+	statusCode := http.StatusOK
+	if res.Status != healthStatusOK {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	server.writeHealthResponse(w, statusCode, res)
+}
+
+// readinessHandler reports if all components are healthy
+func (server *Server) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	res := server.checkHealth()
+
+	statusCode := http.StatusOK
+	if res.Status != healthStatusOK {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	server.writeHealthResponse(w, statusCode, res)
+}
+
+// checkHealth checks all components, the time a component became unhealthy is kept until it is healthy again.
+// It is only updated when checked, which the probes do regularly.
+func (server *Server) checkHealth() healthResponse {
+	res := healthResponse{
+		Status:     healthStatusOK,
+		Components: make(map[string]healthComponent),
+	}
+
+	server.unhealthySinceMu.Lock()
+	defer server.unhealthySinceMu.Unlock()
+
+	for _, checker := range server.healthCheckers {
+		name := checker.HealthName()
+		component := healthComponent{
+			Status: healthStatusOK,
+		}
+
+		err := checker.Health()
+		if err != nil {
+			since, found := server.unhealthySince[name]
+			if !found {
+				since = time.Now()
+				server.unhealthySince[name] = since
+			}
+
+			component.Status = healthStatusUnavailable
+			component.ErrorMessage = err.Error()
+			component.UnhealthySince = &since
+			res.Status = healthStatusUnavailable
+		} else {
+			delete(server.unhealthySince, name)
+		}
+
+		res.Components[name] = component
+	}
+
+	return res
+}
+
+func (server *Server) writeHealthResponse(w http.ResponseWriter, statusCode int, res healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	err := json.NewEncoder(w).Encode(res)
+	if err != nil {
+		server.statusClient.Warn("Unable to write health response", "error", err)
+	}
+}
@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
 	"github.com/xenitab/mqtt-log-stdout/pkg/status"
+	"github.com/xenitab/mqtt-log-stdout/pkg/tail"
+	"golang.org/x/sync/errgroup"
 )
 
 // Options takes the input configuration for the metrics server
@@ -17,53 +22,196 @@ type Options struct {
 	Address      string
 	Port         int
 	StatusClient status.Client
+	// Registry is the registry exposed on /metrics
+	Registry *prometheus.Registry
+	// HealthCheckers are the components reported by /healthz and /readyz
+	HealthCheckers []h.ServiceHealthChecker
+	// LivenessThreshold is how long a component can be unhealthy before /healthz fails (0 = /healthz always succeeds)
+	LivenessThreshold time.Duration
+	// DebugEnabled exposes pprof and /debug/state on DebugAddress and DebugPort
+	DebugEnabled bool
+	DebugAddress string
+	DebugPort    int
+	// DebugStateReporters are the components reported by /debug/state
+	DebugStateReporters []h.ServiceDebugStateReporter
+	// TLSCertFile and TLSKeyFile enables TLS, the files are loaded again when changed
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile requires client certificates signed by the CA (mTLS) for all endpoints except /healthz and /readyz
+	TLSClientCAFile string
+	// BasicAuthUsername and BasicAuthPassword requires basic auth for all endpoints except /healthz and /readyz
+	BasicAuthUsername string
+	BasicAuthPassword string
+	// BasicAuthPasswordFile is used instead of BasicAuthPassword when set, read again when changed
+	BasicAuthPasswordFile string
+	// BearerToken requires the token for all endpoints except /healthz and /readyz
+	BearerToken string
+	// BearerTokenFile is used instead of BearerToken when set, read again when changed
+	BearerTokenFile string
+	// TailBroker enables /tail, streaming received messages, when set
+	TailBroker *tail.Broker
+	// SubscriptionManager enables the admin API (/admin/*) when set, authentication should be configured when used
+	SubscriptionManager h.ServiceSubscriptionManager
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	IdleTimeout         time.Duration
 }
 
 // Server contains the metrics server struct
 type Server struct {
-	httpServer   *http.Server
-	statusClient status.Client
+	httpServer          *http.Server
+	debugServer         *http.Server
+	tlsCertFile         string
+	tlsKeyFile          string
+	tlsClientCAFile     string
+	auth                authOptions
+	subscriptionManager h.ServiceSubscriptionManager
+	tailBroker          *tail.Broker
+	tailCtx             context.Context
+	tailCancel          context.CancelFunc
+	statusClient        status.Client
+	healthCheckers      []h.ServiceHealthChecker
+	livenessThreshold   time.Duration
+	unhealthySince      map[string]time.Time
+	unhealthySinceMu    sync.Mutex
+	debugStateReporters []h.ServiceDebugStateReporter
 }
 
 // NewServer returns a metrics server
 func NewServer(opts Options) *Server {
+	server := &Server{
+		statusClient:        opts.StatusClient,
+		healthCheckers:      opts.HealthCheckers,
+		livenessThreshold:   opts.LivenessThreshold,
+		unhealthySince:      make(map[string]time.Time),
+		debugStateReporters: opts.DebugStateReporters,
+		subscriptionManager: opts.SubscriptionManager,
+		tailBroker:          opts.TailBroker,
+		tlsCertFile:         opts.TLSCertFile,
+		tlsKeyFile:          opts.TLSKeyFile,
+		tlsClientCAFile:     opts.TLSClientCAFile,
+		auth: authOptions{
+			basicAuthUsername: opts.BasicAuthUsername,
+			basicAuthPassword: newSecret(opts.BasicAuthPassword, opts.BasicAuthPasswordFile, opts.StatusClient),
+			bearerToken:       newSecret(opts.BearerToken, opts.BearerTokenFile, opts.StatusClient),
+			requireClientCert: opts.TLSClientCAFile != "",
+		},
+	}
+
+	registry := opts.Registry
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+	}
+
 	router := mux.NewRouter()
-	router.Handle("/metrics", promhttp.Handler())
-	listenAddress := net.JoinHostPort(opts.Address, fmt.Sprintf("%d", opts.Port))
+	router.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	router.HandleFunc("/healthz", server.livenessHandler).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", server.readinessHandler).Methods(http.MethodGet)
+	if server.subscriptionManager != nil {
+		server.addAdminRoutes(router)
+	}
+	if server.tailBroker != nil {
+		router.HandleFunc("/tail", server.tailHandler).Methods(http.MethodGet)
+	}
+	server.httpServer = server.newHTTPServer(opts.Address, opts.Port, router, opts)
 
-	srv := &http.Server{
-		Addr:              listenAddress,
-		Handler:           router,
-		ReadHeaderTimeout: 10 * time.Second,
+	// Shutdown() doesn't wait for or cancel streaming requests, they are stopped by canceling tailCtx
+	server.tailCtx, server.tailCancel = context.WithCancel(context.Background())
+	server.httpServer.RegisterOnShutdown(server.tailCancel)
+
+	if opts.DebugEnabled {
+		server.debugServer = server.newHTTPServer(opts.DebugAddress, opts.DebugPort, server.newDebugRouter(), opts)
 	}
 
-	return &Server{
-		httpServer:   srv,
-		statusClient: opts.StatusClient,
+	return server
+}
+
+// newHTTPServer returns a http server with the timeouts and authentication from the options
+func (server *Server) newHTTPServer(address string, port int, router *mux.Router, opts Options) *http.Server {
+	if server.auth.enabled() {
+		router.Use(server.authMiddleware)
+	}
+
+	return &http.Server{
+		Addr:              net.JoinHostPort(address, fmt.Sprintf("%d", port)),
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       opts.ReadTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       opts.IdleTimeout,
 	}
 }
 
 // Start starts the server
 func (server *Server) Start(ctx context.Context) error {
-	server.statusClient.Print("Metrics server starting", nil)
-	err := server.httpServer.ListenAndServe()
+	tlsConfig, err := newTLSConfig(server.tlsCertFile, server.tlsKeyFile, server.tlsClientCAFile, server.statusClient)
+	if err != nil {
+		server.statusClient.Error("Metrics server unable to configure TLS", "error", err)
+		return err
+	}
+
+	for _, srv := range server.httpServers() {
+		srv.TLSConfig = tlsConfig
+	}
+
+	g := &errgroup.Group{}
+
+	server.statusClient.Info("Metrics server starting", "address", server.httpServer.Addr, "tls", tlsConfig != nil)
+	g.Go(func() error {
+		return server.listenAndServe(server.httpServer, "metrics")
+	})
+
+	if server.debugServer != nil {
+		server.statusClient.Info("Debug server starting", "address", server.debugServer.Addr)
+		g.Go(func() error {
+			return server.listenAndServe(server.debugServer, "debug")
+		})
+	}
+
+	return g.Wait()
+}
+
+// listenAndServe closes all http servers if one of them fails, to make sure Start() returns the error
+func (server *Server) listenAndServe(srv *http.Server, name string) error {
+	var err error
+	if srv.TLSConfig != nil {
+		// The certificate is provided by TLSConfig.GetCertificate
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+
 	if err != nil && err != http.ErrServerClosed {
-		server.statusClient.Print("Metrics server failed to start or stop gracefully", err)
+		server.statusClient.Error("Server failed to start or stop gracefully", "server", name, "error", err)
+		for _, s := range server.httpServers() {
+			s.Close()
+		}
 		return err
 	}
+
 	return nil
 }
 
 // StopWithContext takes a context and stops the server
 func (server *Server) Stop(ctx context.Context) error {
-	// Shutdown the http server
-	err := server.httpServer.Shutdown(ctx)
-	if err != nil {
-		server.statusClient.Print("Metrics server failed to stop gracefully", err)
-		return err
+	// Shutdown the http servers
+	for _, srv := range server.httpServers() {
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			server.statusClient.Error("Metrics server failed to stop gracefully", "error", err)
+			return err
+		}
 	}
 
-	server.statusClient.Print("Metrics server stopped", nil)
+	server.statusClient.Info("Metrics server stopped")
 
 	return nil
 }
+
+func (server *Server) httpServers() []*http.Server {
+	if server.debugServer == nil {
+		return []*http.Server{server.httpServer}
+	}
+
+	return []*http.Server{server.httpServer, server.debugServer}
+}
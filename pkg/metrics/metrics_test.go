@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -23,10 +24,14 @@ func TestStart(t *testing.T) {
 
 	statusClient := testNewFakeStatusClient(t)
 
+	registry, registerer, err := NewRegistry(RegistryOptions{Version: "v0.0.0-fake"})
+	require.NoError(t, err)
+
 	opts := Options{
 		Address:      "0.0.0.0",
 		Port:         8080,
 		StatusClient: statusClient,
+		Registry:     registry,
 	}
 	metricsServer := NewServer(opts)
 
@@ -42,7 +47,7 @@ func TestStart(t *testing.T) {
 		time.Sleep(10 * time.Millisecond)
 	}
 
-	fakeCounter := promauto.NewCounter(prometheus.CounterOpts{
+	fakeCounter := promauto.With(registerer).NewCounter(prometheus.CounterOpts{
 		Name: "fake_counter",
 		Help: "fake counter",
 	})
@@ -62,7 +67,7 @@ func TestStart(t *testing.T) {
 		})
 	}
 
-	err := h.WaitForErrGroup(incrementerErrGroup)
+	err = h.WaitForErrGroup(incrementerErrGroup)
 	require.NoError(t, err)
 
 	metrics := testGetPrometheusMetrics(t, "http://localhost:8080/metrics")
@@ -79,6 +84,181 @@ func TestStart(t *testing.T) {
 
 	messageCount := int(*metrics["fake_counter"].Metric[0].Counter.Value)
 	require.Equal(t, expectedMessageCount, messageCount)
+	require.Contains(t, metrics, "mqtt_log_stdout_build_info")
+	require.Contains(t, metrics, "go_goroutines")
+}
+
+func TestNewRegistry(t *testing.T) {
+	registry, registerer, err := NewRegistry(RegistryOptions{
+		Namespace:   "fake",
+		ConstLabels: map[string]string{"cluster": "fake-cluster"},
+		Version:     "v0.0.0-fake",
+		Revision:    "fake-revision",
+		Created:     "fake-created",
+	})
+	require.NoError(t, err)
+
+	fakeCounter := promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Name: "fake_counter",
+		Help: "fake counter",
+	})
+	fakeCounter.Inc()
+
+	metricFamilies, err := registry.Gather()
+	require.NoError(t, err)
+
+	metrics := make(map[string]*dto.MetricFamily)
+	for _, mf := range metricFamilies {
+		metrics[mf.GetName()] = mf
+	}
+
+	require.Contains(t, metrics, "fake_fake_counter")
+	require.Contains(t, metrics, "go_goroutines")
+	require.NotContains(t, metrics, "fake_go_goroutines")
+
+	buildInfo, found := metrics["fake_mqtt_log_stdout_build_info"]
+	require.True(t, found)
+
+	labels := make(map[string]string)
+	for _, label := range buildInfo.Metric[0].Label {
+		labels[label.GetName()] = label.GetValue()
+	}
+
+	require.Equal(t, "v0.0.0-fake", labels["version"])
+	require.Equal(t, "fake-revision", labels["revision"])
+	require.Equal(t, "fake-created", labels["created"])
+	require.Equal(t, "fake-cluster", labels["cluster"])
+
+	for _, label := range metrics["go_goroutines"].Metric[0].Label {
+		require.Equal(t, "cluster", label.GetName())
+	}
+}
+
+func TestHealthHandlers(t *testing.T) {
+	cases := []struct {
+		testDescription       string
+		healthCheckers        []h.ServiceHealthChecker
+		expectedLivenessCode  int
+		expectedReadinessCode int
+		expectedBody          string
+	}{
+		{
+			testDescription:       "No components",
+			healthCheckers:        []h.ServiceHealthChecker{},
+			expectedLivenessCode:  http.StatusOK,
+			expectedReadinessCode: http.StatusOK,
+			expectedBody:          `"status":"ok"`,
+		},
+		{
+			testDescription: "All components healthy",
+			healthCheckers: []h.ServiceHealthChecker{
+				&testFakeHealthChecker{name: "mqtt"},
+				&testFakeHealthChecker{name: "message"},
+			},
+			expectedLivenessCode:  http.StatusOK,
+			expectedReadinessCode: http.StatusOK,
+			expectedBody:          `"mqtt":{"status":"ok"}`,
+		},
+		{
+			testDescription: "One component unhealthy",
+			healthCheckers: []h.ServiceHealthChecker{
+				&testFakeHealthChecker{name: "mqtt", err: fmt.Errorf("fake error")},
+				&testFakeHealthChecker{name: "message"},
+			},
+			expectedLivenessCode:  http.StatusOK,
+			expectedReadinessCode: http.StatusServiceUnavailable,
+			expectedBody:          `"mqtt":{"status":"unavailable","error":"fake error","unhealthy_since":`,
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		metricsServer := NewServer(Options{
+			StatusClient:   testNewFakeStatusClient(t),
+			HealthCheckers: c.healthCheckers,
+		})
+
+		liveness := httptest.NewRecorder()
+		metricsServer.httpServer.Handler.ServeHTTP(liveness, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		require.Equal(t, c.expectedLivenessCode, liveness.Code)
+		require.Equal(t, "application/json", liveness.Header().Get("Content-Type"))
+
+		readiness := httptest.NewRecorder()
+		metricsServer.httpServer.Handler.ServeHTTP(readiness, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		require.Equal(t, c.expectedReadinessCode, readiness.Code)
+		require.Contains(t, readiness.Body.String(), c.expectedBody)
+	}
+}
+
+func TestLivenessThreshold(t *testing.T) {
+	checker := &testFakeHealthChecker{name: "mqtt", err: fmt.Errorf("fake not connected")}
+	metricsServer := NewServer(Options{
+		StatusClient:      testNewFakeStatusClient(t),
+		HealthCheckers:    []h.ServiceHealthChecker{checker},
+		LivenessThreshold: 50 * time.Millisecond,
+	})
+
+	liveness := func() *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		metricsServer.httpServer.Handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return res
+	}
+
+	// A component that just became unhealthy only fails the readiness
+	res := liveness()
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), `"unhealthy_since"`)
+
+	// The liveness fails when the component is unhealthy for longer than the threshold
+	time.Sleep(100 * time.Millisecond)
+	res = liveness()
+	require.Equal(t, http.StatusServiceUnavailable, res.Code)
+	require.Contains(t, res.Body.String(), `"error":"mqtt unhealthy for`)
+
+	// The time is reset when the component is healthy again
+	checker.err = nil
+	require.Equal(t, http.StatusOK, liveness().Code)
+	checker.err = fmt.Errorf("fake not connected")
+	require.Equal(t, http.StatusOK, liveness().Code)
+}
+
+func TestDebugHandlers(t *testing.T) {
+	metricsServer := NewServer(Options{
+		StatusClient: testNewFakeStatusClient(t),
+	})
+	require.Nil(t, metricsServer.debugServer)
+	require.Len(t, metricsServer.httpServers(), 1)
+
+	// The debug endpoints aren't exposed on the metrics server
+	res := httptest.NewRecorder()
+	metricsServer.httpServer.Handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/debug/state", nil))
+	require.Equal(t, http.StatusNotFound, res.Code)
+
+	metricsServer = NewServer(Options{
+		StatusClient:        testNewFakeStatusClient(t),
+		DebugEnabled:        true,
+		DebugAddress:        "127.0.0.1",
+		DebugPort:           6060,
+		DebugStateReporters: []h.ServiceDebugStateReporter{&testFakeDebugStateReporter{name: "mqtt", state: map[string]int{"reconnect_count": 3}}},
+	})
+	require.Equal(t, "127.0.0.1:6060", metricsServer.debugServer.Addr)
+	require.Len(t, metricsServer.httpServers(), 2)
+
+	res = httptest.NewRecorder()
+	metricsServer.debugServer.Handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/debug/state", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, "application/json", res.Header().Get("Content-Type"))
+	require.JSONEq(t, `{"mqtt":{"reconnect_count":3}}`, res.Body.String())
+
+	res = httptest.NewRecorder()
+	metricsServer.debugServer.Handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), "goroutine")
+
+	res = httptest.NewRecorder()
+	metricsServer.debugServer.Handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/debug/pprof/cmdline", nil))
+	require.Equal(t, http.StatusOK, res.Code)
 }
 
 func TestMain(m *testing.M) {
@@ -97,10 +277,48 @@ func testNewFakeStatusClient(t *testing.T) status.Client {
 	}
 }
 
-func (s *testFakeStatus) Print(m string, e error) {
+func (s *testFakeStatus) Debug(m string, args ...any) {
+	s.t.Helper()
+}
+
+func (s *testFakeStatus) Info(m string, args ...any) {
+	s.t.Helper()
+}
+
+func (s *testFakeStatus) Warn(m string, args ...any) {
+	s.t.Helper()
+}
+
+func (s *testFakeStatus) Error(m string, args ...any) {
 	s.t.Helper()
 }
 
+type testFakeHealthChecker struct {
+	name string
+	err  error
+}
+
+func (checker *testFakeHealthChecker) HealthName() string {
+	return checker.name
+}
+
+func (checker *testFakeHealthChecker) Health() error {
+	return checker.err
+}
+
+type testFakeDebugStateReporter struct {
+	name  string
+	state interface{}
+}
+
+func (reporter *testFakeDebugStateReporter) DebugStateName() string {
+	return reporter.name
+}
+
+func (reporter *testFakeDebugStateReporter) DebugState() interface{} {
+	return reporter.state
+}
+
 func testGetPrometheusMetrics(t *testing.T, url string) map[string]*dto.MetricFamily {
 	t.Helper()
 
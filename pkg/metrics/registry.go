@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// RegistryOptions takes the input configuration for the metrics registry
+type RegistryOptions struct {
+	// Namespace is used as prefix for the application metrics (not for the Go runtime and process metrics)
+	Namespace string
+	// ConstLabels are added to all metrics
+	ConstLabels map[string]string
+	Version     string
+	Revision    string
+	Created     string
+}
+
+// NewRegistry returns a registry with the Go runtime, process and build info metrics registered
+// together with the registerer that should be used for the application metrics
+func NewRegistry(opts RegistryOptions) (*prometheus.Registry, prometheus.Registerer, error) {
+	registry := prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(opts.ConstLabels, registry)
+
+	err := registerer.Register(collectors.NewGoCollector())
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to register go collector: %w", err)
+	}
+
+	err = registerer.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to register process collector: %w", err)
+	}
+
+	if opts.Namespace != "" {
+		registerer = prometheus.WrapRegistererWithPrefix(fmt.Sprintf("%s_", opts.Namespace), registerer)
+	}
+
+	buildInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mqtt_log_stdout_build_info",
+		Help: "Build information about mqtt-log-stdout, always set to 1",
+		ConstLabels: prometheus.Labels{
+			"version":   opts.Version,
+			"revision":  opts.Revision,
+			"created":   opts.Created,
+			"goversion": runtime.Version(),
+		},
+	})
+	buildInfo.Set(1)
+
+	err = registerer.Register(buildInfo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to register build info: %w", err)
+	}
+
+	return registry, registerer, nil
+}
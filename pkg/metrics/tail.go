@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xenitab/mqtt-log-stdout/pkg/mqtt"
+	"github.com/xenitab/mqtt-log-stdout/pkg/tail"
+)
+
+const (
+	tailKeepAliveInterval = 15 * time.Second
+	tailWriteTimeout      = 10 * time.Second
+)
+
+// tailHandler streams received messages as Server-Sent Events, or WebSocket messages when the request is a WebSocket upgrade.
+// The query parameters topic (MQTT topic filter) and payload (regular expression) filter the messages.
+func (server *Server) tailHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := newTailFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	subscriber, err := server.tailBroker.Subscribe(filter)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, tail.ErrTooManyClients) {
+			statusCode = http.StatusServiceUnavailable
+		}
+
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	server.statusClient.Info("Tail client connected", "remote_address", r.RemoteAddr, "topic", filter.Topic)
+	defer func() {
+		slow := server.tailBroker.Unsubscribe(subscriber)
+		if slow {
+			server.statusClient.Warn("Tail client disconnected, it didn't keep up", "remote_address", r.RemoteAddr)
+			return
+		}
+
+		server.statusClient.Info("Tail client disconnected", "remote_address", r.RemoteAddr)
+	}()
+
+	if websocket.IsWebSocketUpgrade(r) {
+		server.serveTailWebSocket(w, r, subscriber)
+		return
+	}
+
+	server.serveTailSSE(w, r, subscriber)
+}
+
+func newTailFilter(r *http.Request) (tail.Filter, error) {
+	filter := tail.Filter{
+		Topic: r.URL.Query().Get("topic"),
+	}
+
+	if filter.Topic != "" {
+		err := mqtt.ValidateTopicFilter(filter.Topic)
+		if err != nil {
+			return tail.Filter{}, err
+		}
+	}
+
+	payload := r.URL.Query().Get("payload")
+	if payload != "" {
+		payloadRegexp, err := regexp.Compile(payload)
+		if err != nil {
+			return tail.Filter{}, fmt.Errorf("invalid payload regular expression: %w", err)
+		}
+
+		filter.Payload = payloadRegexp
+	}
+
+	return filter, nil
+}
+
+func (server *Server) serveTailSSE(w http.ResponseWriter, r *http.Request, subscriber *tail.Subscriber) {
+	// The response controller also finds the methods of wrapped response writers (using Unwrap)
+	rc := http.NewResponseController(w)
+
+	// The stream is kept open longer than the server write timeout
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		http.Error(w, "streaming isn't supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	err = rc.Flush()
+	if err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(tailKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		var event string
+		disconnected := false
+		select {
+		case <-r.Context().Done():
+			return
+		case <-server.tailCtx.Done():
+			return
+		case <-subscriber.Done():
+			disconnected = true
+			event = "event: disconnected\ndata: too slow\n\n"
+		case <-keepAlive.C:
+			event = ": keepalive\n\n"
+		case message := <-subscriber.Messages():
+			if !subscriber.Match(message) {
+				continue
+			}
+
+			data, err := json.Marshal(message)
+			if err != nil {
+				return
+			}
+
+			event = fmt.Sprintf("event: message\ndata: %s\n\n", data)
+		}
+
+		_, err := fmt.Fprint(w, event)
+		if err != nil {
+			return
+		}
+
+		err = rc.Flush()
+		if err != nil {
+			return
+		}
+
+		if disconnected {
+			return
+		}
+	}
+}
+
+func (server *Server) serveTailWebSocket(w http.ResponseWriter, r *http.Request, subscriber *tail.Subscriber) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded to the client
+		return
+	}
+
+	// Messages from the client are discarded, reading is required to handle control messages and to notice when it disconnects
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		for {
+			_, _, err := conn.NextReader()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	defer func() {
+		conn.Close()
+		<-readDone
+	}()
+
+	keepAlive := time.NewTicker(tailKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	closeConn := func(code int, text string) {
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(tailWriteTimeout))
+	}
+
+	for {
+		select {
+		case <-readDone:
+			return
+		case <-server.tailCtx.Done():
+			closeConn(websocket.CloseGoingAway, "server stopping")
+			return
+		case <-subscriber.Done():
+			closeConn(websocket.CloseTryAgainLater, "too slow")
+			return
+		case <-keepAlive.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(tailWriteTimeout))
+			if err != nil {
+				return
+			}
+		case message := <-subscriber.Messages():
+			if !subscriber.Match(message) {
+				continue
+			}
+
+			err := conn.SetWriteDeadline(time.Now().Add(tailWriteTimeout))
+			if err != nil {
+				return
+			}
+
+			err = conn.WriteJSON(message)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"github.com/xenitab/mqtt-log-stdout/pkg/tail"
+)
+
+func TestTailHandler(t *testing.T) {
+	tailBroker := tail.NewBroker(tail.Options{
+		BufferSize: 10,
+		MaxClients: 10,
+	})
+
+	metricsServer := NewServer(Options{
+		StatusClient: testNewFakeStatusClient(t),
+		TailBroker:   tailBroker,
+	})
+
+	httpServer := httptest.NewServer(metricsServer.httpServer.Handler)
+	defer httpServer.Close()
+	defer metricsServer.tailCancel()
+
+	// Invalid filters
+	for _, query := range []string{"topic=devices/%23/logs", "payload=%28"} {
+		res, err := http.Get(httpServer.URL + "/tail?" + query)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	}
+
+	// Server-Sent Events
+	res, err := http.Get(httpServer.URL + "/tail?topic=devices/%2B/logs&payload=error")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	testWaitForTailClients(t, tailBroker, 1)
+	tailBroker.Observe("devices/device-1/logs", []byte("fake message"), time.Now())
+	tailBroker.Observe("devices/device-1/logs", []byte("fake error"), time.Now())
+
+	reader := bufio.NewReader(res.Body)
+	event, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "event: message\n", event)
+
+	data, err := reader.ReadString('\n')
+	require.NoError(t, err)
+
+	var message tail.Message
+	err = json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &message)
+	require.NoError(t, err)
+	require.Equal(t, "devices/device-1/logs", message.Topic)
+	require.Equal(t, "fake error", message.Payload)
+
+	// WebSocket
+	wsURL := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/tail?topic=devices/%23"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	testWaitForTailClients(t, tailBroker, 2)
+	tailBroker.Observe("fake/topic", []byte("fake filtered message"), time.Now())
+	tailBroker.Observe("devices/device-2/logs", []byte("fake websocket message"), time.Now())
+
+	err = conn.ReadJSON(&message)
+	require.NoError(t, err)
+	require.Equal(t, "devices/device-2/logs", message.Topic)
+	require.Equal(t, "fake websocket message", message.Payload)
+
+	// Streams are stopped when the server is shut down
+	metricsServer.tailCancel()
+
+	_, _, err = conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+	testWaitForTailClients(t, tailBroker, 0)
+}
+
+func TestTailSSEWriteTimeout(t *testing.T) {
+	tailBroker := tail.NewBroker(tail.Options{
+		BufferSize: 10,
+		MaxClients: 10,
+	})
+
+	metricsServer := NewServer(Options{
+		StatusClient: testNewFakeStatusClient(t),
+		TailBroker:   tailBroker,
+	})
+	defer metricsServer.tailCancel()
+
+	// The stream is served by a wrapped response writer, like a middleware would do
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metricsServer.httpServer.Handler.ServeHTTP(&testWrappedResponseWriter{ResponseWriter: w}, r)
+	})
+
+	httpServer := httptest.NewUnstartedServer(handler)
+	httpServer.Config.WriteTimeout = 100 * time.Millisecond
+	httpServer.Start()
+	defer httpServer.Close()
+
+	res, err := http.Get(httpServer.URL + "/tail")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	// The stream outlives the server write timeout
+	testWaitForTailClients(t, tailBroker, 1)
+	time.Sleep(300 * time.Millisecond)
+	tailBroker.Observe("devices/device-1/logs", []byte("fake message"), time.Now())
+
+	event, err := bufio.NewReader(res.Body).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "event: message\n", event)
+}
+
+type testWrappedResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *testWrappedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func testWaitForTailClients(t *testing.T, tailBroker *tail.Broker, expected int) {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		if tailBroker.Clients() == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	require.Equal(t, expected, tailBroker.Clients())
+}
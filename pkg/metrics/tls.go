@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/xenitab/mqtt-log-stdout/pkg/status"
+)
+
+// certReloader loads the certificate again when the certificate or key file is changed (for example a renewed Kubernetes secret)
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	statusClient status.Client
+	mu           sync.RWMutex
+	cert         *tls.Certificate
+	certModTime  time.Time
+	keyModTime   time.Time
+}
+
+func newCertReloader(certFile string, keyFile string, statusClient status.Client) (*certReloader, error) {
+	reloader := &certReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		statusClient: statusClient,
+	}
+
+	err := reloader.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// getCertificate is used as tls.Config.GetCertificate, the previous certificate is kept if the new one can't be loaded
+func (reloader *certReloader) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if reloader.changed() {
+		err := reloader.reload()
+		if err != nil {
+			reloader.statusClient.Warn("Unable to reload metrics server certificate, using the previous one", "cert_file", reloader.certFile, "error", err)
+		} else {
+			reloader.statusClient.Info("Metrics server certificate reloaded", "cert_file", reloader.certFile)
+		}
+	}
+
+	reloader.mu.RLock()
+	defer reloader.mu.RUnlock()
+
+	return reloader.cert, nil
+}
+
+func (reloader *certReloader) changed() bool {
+	certModTime, keyModTime, err := reloader.modTimes()
+	if err != nil {
+		return false
+	}
+
+	reloader.mu.RLock()
+	defer reloader.mu.RUnlock()
+
+	return !certModTime.Equal(reloader.certModTime) || !keyModTime.Equal(reloader.keyModTime)
+}
+
+func (reloader *certReloader) reload() error {
+	certModTime, keyModTime, err := reloader.modTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load certificate %q and key %q: %w", reloader.certFile, reloader.keyFile, err)
+	}
+
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+
+	reloader.cert = &cert
+	reloader.certModTime = certModTime
+	reloader.keyModTime = keyModTime
+
+	return nil
+}
+
+func (reloader *certReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(reloader.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	keyInfo, err := os.Stat(reloader.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// clientCAReloader loads the client CA again when the file is changed, the same way as certReloader. The tls config
+// using the client CA is only created when it is (re)loaded, which keeps the session ticket keys between connections.
+type clientCAReloader struct {
+	caFile       string
+	baseConfig   *tls.Config
+	statusClient status.Client
+	mu           sync.RWMutex
+	config       *tls.Config
+	modTime      time.Time
+}
+
+func newClientCAReloader(caFile string, baseConfig *tls.Config, statusClient status.Client) (*clientCAReloader, error) {
+	reloader := &clientCAReloader{
+		caFile:       caFile,
+		baseConfig:   baseConfig,
+		statusClient: statusClient,
+	}
+
+	err := reloader.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// getConfigForClient is used as tls.Config.GetConfigForClient, the previous client CA is kept if the new one can't be loaded
+func (reloader *clientCAReloader) getConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	if reloader.changed() {
+		err := reloader.reload()
+		if err != nil {
+			reloader.statusClient.Warn("Unable to reload metrics client CA, using the previous one", "client_ca_file", reloader.caFile, "error", err)
+		} else {
+			reloader.statusClient.Info("Metrics client CA reloaded", "client_ca_file", reloader.caFile)
+		}
+	}
+
+	reloader.mu.RLock()
+	defer reloader.mu.RUnlock()
+
+	return reloader.config, nil
+}
+
+func (reloader *clientCAReloader) changed() bool {
+	info, err := os.Stat(reloader.caFile)
+	if err != nil {
+		return false
+	}
+
+	reloader.mu.RLock()
+	defer reloader.mu.RUnlock()
+
+	return !info.ModTime().Equal(reloader.modTime)
+}
+
+func (reloader *clientCAReloader) reload() error {
+	info, err := os.Stat(reloader.caFile)
+	if err != nil {
+		return fmt.Errorf("unable to read client CA %q: %w", reloader.caFile, err)
+	}
+
+	caPEM, err := os.ReadFile(reloader.caFile)
+	if err != nil {
+		return fmt.Errorf("unable to read client CA %q: %w", reloader.caFile, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates found in client CA %q", reloader.caFile)
+	}
+
+	config := reloader.baseConfig.Clone()
+	config.ClientCAs = pool
+
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+
+	reloader.config = config
+	reloader.modTime = info.ModTime()
+
+	return nil
+}
+
+// newTLSConfig returns the tls config for the http servers, or nil if TLS isn't enabled
+func newTLSConfig(certFile string, keyFile string, clientCAFile string, statusClient status.Client) (*tls.Config, error) {
+	if certFile == "" {
+		return nil, nil
+	}
+
+	reloader, err := newCertReloader(certFile, keyFile, statusClient)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}
+
+	if clientCAFile != "" {
+		// Client certificates are verified if given and required by authMiddleware(), to not break probes for /healthz and /readyz
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+		// The client CA is checked for changes on every connection, so a rotated CA doesn't require a restart
+		caReloader, err := newClientCAReloader(clientCAFile, tlsConfig.Clone(), statusClient)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.GetConfigForClient = caReloader.getConfigForClient
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,304 @@
+package metrics
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertReloader(t *testing.T) {
+	tmpDir := t.TempDir()
+	certFile := filepath.Join(tmpDir, "tls.crt")
+	keyFile := filepath.Join(tmpDir, "tls.key")
+
+	ca := testNewCA(t)
+	testWriteCert(t, ca, "first", certFile, keyFile, time.Now().Add(-time.Minute))
+
+	_, err := newCertReloader(certFile, "/does/not/exist", testNewFakeStatusClient(t))
+	require.Error(t, err)
+
+	reloader, err := newCertReloader(certFile, keyFile, testNewFakeStatusClient(t))
+	require.NoError(t, err)
+	require.Equal(t, "first", testCertCommonName(t, reloader))
+
+	// The certificate is reloaded when the files are changed
+	testWriteCert(t, ca, "second", certFile, keyFile, time.Now())
+	require.Equal(t, "second", testCertCommonName(t, reloader))
+
+	// The previous certificate is used if the new one can't be loaded
+	err = os.WriteFile(keyFile, []byte("fake"), 0600)
+	require.NoError(t, err)
+	err = os.Chtimes(keyFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, "second", testCertCommonName(t, reloader))
+}
+
+func TestClientCAReloader(t *testing.T) {
+	tmpDir := t.TempDir()
+	caFile := filepath.Join(tmpDir, "ca.crt")
+
+	firstCA := testNewCA(t)
+	testWriteCA(t, firstCA, caFile, time.Now().Add(-time.Minute))
+
+	baseConfig := &tls.Config{MinVersion: tls.VersionTLS12, ClientAuth: tls.VerifyClientCertIfGiven}
+	_, err := newClientCAReloader("/does/not/exist", baseConfig, testNewFakeStatusClient(t))
+	require.Error(t, err)
+
+	reloader, err := newClientCAReloader(caFile, baseConfig, testNewFakeStatusClient(t))
+	require.NoError(t, err)
+	require.True(t, testCertPool(firstCA).Equal(testClientCAs(t, reloader)))
+	require.Equal(t, tls.VerifyClientCertIfGiven, testConfigForClient(t, reloader).ClientAuth)
+
+	// The same config is used until the client CA changes, to be able to resume sessions
+	require.Same(t, testConfigForClient(t, reloader), testConfigForClient(t, reloader))
+
+	// The client CA is reloaded when the file is changed
+	secondCA := testNewCA(t)
+	testWriteCA(t, secondCA, caFile, time.Now())
+	require.True(t, testCertPool(secondCA).Equal(testClientCAs(t, reloader)))
+
+	// The previous client CA is used if the new one can't be loaded
+	err = os.WriteFile(caFile, []byte("fake"), 0600)
+	require.NoError(t, err)
+	err = os.Chtimes(caFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, testCertPool(secondCA).Equal(testClientCAs(t, reloader)))
+}
+
+func TestTLSWithClientCA(t *testing.T) {
+	tmpDir := t.TempDir()
+	certFile := filepath.Join(tmpDir, "tls.crt")
+	keyFile := filepath.Join(tmpDir, "tls.key")
+	clientCertFile := filepath.Join(tmpDir, "client.crt")
+	clientKeyFile := filepath.Join(tmpDir, "client.key")
+	caFile := filepath.Join(tmpDir, "ca.crt")
+
+	ca := testNewCA(t)
+	testWriteCert(t, ca, "127.0.0.1", certFile, keyFile, time.Now())
+	testWriteCert(t, ca, "client", clientCertFile, clientKeyFile, time.Now())
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600)
+	require.NoError(t, err)
+
+	metricsServer := NewServer(Options{
+		StatusClient:    testNewFakeStatusClient(t),
+		TLSCertFile:     certFile,
+		TLSKeyFile:      keyFile,
+		TLSClientCAFile: caFile,
+	})
+
+	tlsConfig, err := newTLSConfig(certFile, keyFile, caFile, testNewFakeStatusClient(t))
+	require.NoError(t, err)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+
+	srv := &http.Server{Handler: metricsServer.httpServer.Handler, ReadHeaderTimeout: time.Second}
+	go srv.Serve(listener) //nolint:errcheck
+	defer srv.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.cert)
+
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	require.NoError(t, err)
+
+	cases := []struct {
+		testDescription string
+		certificates    []tls.Certificate
+		path            string
+		expectedCode    int
+	}{
+		{
+			testDescription: "Health endpoint without client certificate",
+			certificates:    nil,
+			path:            "/healthz",
+			expectedCode:    http.StatusOK,
+		},
+		{
+			testDescription: "Metrics endpoint without client certificate",
+			certificates:    nil,
+			path:            "/metrics",
+			expectedCode:    http.StatusUnauthorized,
+		},
+		{
+			testDescription: "Metrics endpoint with client certificate",
+			certificates:    []tls.Certificate{clientCert},
+			path:            "/metrics",
+			expectedCode:    http.StatusOK,
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		transport := &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:      rootCAs,
+				Certificates: c.certificates,
+				MinVersion:   tls.VersionTLS12,
+			},
+		}
+		httpClient := &http.Client{Transport: transport}
+
+		res, err := httpClient.Get("https://" + listener.Addr().String() + c.path)
+		require.NoError(t, err)
+		res.Body.Close()
+		transport.CloseIdleConnections()
+		require.Equal(t, c.expectedCode, res.StatusCode)
+	}
+
+	// Sessions are resumed by new connections
+	resumeTransport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			RootCAs:            rootCAs,
+			Certificates:       []tls.Certificate{clientCert},
+			MinVersion:         tls.VersionTLS12,
+			ClientSessionCache: tls.NewLRUClientSessionCache(1),
+		},
+	}
+	resumeClient := &http.Client{Transport: resumeTransport}
+
+	for _, expectedResumed := range []bool{false, true} {
+		res, err := resumeClient.Get("https://" + listener.Addr().String() + "/metrics")
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, res.Body)
+		require.NoError(t, err)
+		res.Body.Close()
+		resumeTransport.CloseIdleConnections()
+		require.Equal(t, expectedResumed, res.TLS.DidResume)
+	}
+
+	// A client certificate from the previous CA is rejected after the client CA is rotated
+	testWriteCA(t, testNewCA(t), caFile, time.Now().Add(time.Minute))
+
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			RootCAs:      rootCAs,
+			Certificates: []tls.Certificate{clientCert},
+			MinVersion:   tls.VersionTLS12,
+		},
+	}
+	defer transport.CloseIdleConnections()
+
+	_, err = (&http.Client{Transport: transport}).Get("https://" + listener.Addr().String() + "/metrics")
+	require.Error(t, err)
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func testNewCA(t *testing.T) testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testCA{cert: cert, key: key}
+}
+
+func testWriteCert(t *testing.T, ca testCA, commonName string, certFile string, keyFile string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	require.NoError(t, err)
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	require.NoError(t, err)
+
+	for _, file := range []string{certFile, keyFile} {
+		err = os.Chtimes(file, modTime, modTime)
+		require.NoError(t, err)
+	}
+}
+
+func testWriteCA(t *testing.T, ca testCA, caFile string, modTime time.Time) {
+	t.Helper()
+
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600)
+	require.NoError(t, err)
+	err = os.Chtimes(caFile, modTime, modTime)
+	require.NoError(t, err)
+}
+
+func testCertPool(ca testCA) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func testConfigForClient(t *testing.T, reloader *clientCAReloader) *tls.Config {
+	t.Helper()
+
+	config, err := reloader.getConfigForClient(nil)
+	require.NoError(t, err)
+
+	return config
+}
+
+func testClientCAs(t *testing.T, reloader *clientCAReloader) *x509.CertPool {
+	t.Helper()
+
+	return testConfigForClient(t, reloader).ClientCAs
+}
+
+func testCertCommonName(t *testing.T, reloader *certReloader) string {
+	t.Helper()
+
+	cert, err := reloader.getCertificate(nil)
+	require.NoError(t, err)
+
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+
+	return parsed.Subject.CommonName
+}
@@ -0,0 +1,40 @@
+package mqtt
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff calculates exponential intervals between connection attempts
+type backoff struct {
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	// jitter is the fraction (0-1) of the interval that is randomized, to keep clients from retrying in lockstep
+	jitter float64
+}
+
+// interval returns the time to wait before the attempt (starting at 1)
+func (b backoff) interval(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	interval := b.initialInterval
+	for i := 1; i < attempt && interval < b.maxInterval; i++ {
+		interval *= 2
+	}
+
+	if b.maxInterval > 0 && interval > b.maxInterval {
+		interval = b.maxInterval
+	}
+
+	if b.jitter <= 0 || interval <= 0 {
+		return interval
+	}
+
+	// Randomize the interval within [interval - jitter, interval + jitter]
+	delta := b.jitter * float64(interval)
+	randomized := float64(interval) - delta + (rand.Float64() * 2 * delta) // #nosec
+
+	return time.Duration(randomized)
+}
@@ -0,0 +1,64 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffInterval(t *testing.T) {
+	cases := []struct {
+		testDescription string
+		backoff         backoff
+		attempt         int
+		expectedMin     time.Duration
+		expectedMax     time.Duration
+	}{
+		{
+			testDescription: "First attempt uses initial interval",
+			backoff:         backoff{initialInterval: time.Second, maxInterval: time.Minute},
+			attempt:         1,
+			expectedMin:     time.Second,
+			expectedMax:     time.Second,
+		},
+		{
+			testDescription: "Interval doubles for every attempt",
+			backoff:         backoff{initialInterval: time.Second, maxInterval: time.Minute},
+			attempt:         4,
+			expectedMin:     8 * time.Second,
+			expectedMax:     8 * time.Second,
+		},
+		{
+			testDescription: "Interval is capped at max interval",
+			backoff:         backoff{initialInterval: time.Second, maxInterval: 10 * time.Second},
+			attempt:         100,
+			expectedMin:     10 * time.Second,
+			expectedMax:     10 * time.Second,
+		},
+		{
+			testDescription: "Jitter randomizes around the interval",
+			backoff:         backoff{initialInterval: 10 * time.Second, maxInterval: time.Minute, jitter: 0.5},
+			attempt:         1,
+			expectedMin:     5 * time.Second,
+			expectedMax:     15 * time.Second,
+		},
+		{
+			testDescription: "Attempt lower than 1 is treated as the first attempt",
+			backoff:         backoff{initialInterval: time.Second, maxInterval: time.Minute},
+			attempt:         0,
+			expectedMin:     time.Second,
+			expectedMax:     time.Second,
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		for j := 0; j < 100; j++ {
+			interval := c.backoff.interval(c.attempt)
+			require.GreaterOrEqual(t, interval, c.expectedMin)
+			require.LessOrEqual(t, interval, c.expectedMax)
+		}
+	}
+}
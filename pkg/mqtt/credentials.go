@@ -0,0 +1,71 @@
+package mqtt
+
+import (
+	"sync"
+
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+	"github.com/xenitab/mqtt-log-stdout/pkg/status"
+)
+
+// CredentialsProvider returns the username and password, it is called on every (re)connect through the paho credentials provider.
+// It can't return an error, implementations are expected to log errors and return the previous credentials instead.
+type CredentialsProvider interface {
+	Credentials() (username string, password string)
+}
+
+// StaticCredentials is a CredentialsProvider with a fixed username and password
+type StaticCredentials struct {
+	Username string
+	Password string
+}
+
+// Credentials returns the fixed username and password
+func (c StaticCredentials) Credentials() (string, string) {
+	return c.Username, c.Password
+}
+
+// fileCredentials reads the username and password files on every (re)connect, to use rotated secrets without a restart.
+// The static username and password are used when the files aren't set.
+type fileCredentials struct {
+	username     string
+	password     string
+	usernameFile string
+	passwordFile string
+	statusClient status.Client
+	mu           sync.Mutex
+}
+
+func newFileCredentials(opts Options) *fileCredentials {
+	return &fileCredentials{
+		username:     opts.Username,
+		password:     opts.Password,
+		usernameFile: opts.UsernameFile,
+		passwordFile: opts.PasswordFile,
+		statusClient: opts.StatusClient,
+	}
+}
+
+// Credentials reads the files, the previous value is kept if a file can't be read
+func (c *fileCredentials) Credentials() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.username = c.readFile(c.usernameFile, c.username)
+	c.password = c.readFile(c.passwordFile, c.password)
+
+	return c.username, c.password
+}
+
+func (c *fileCredentials) readFile(path string, previous string) string {
+	if path == "" {
+		return previous
+	}
+
+	value, err := h.ReadSecretFile(path)
+	if err != nil {
+		c.statusClient.Warn("Unable to read mqtt credentials file, using the previous value", "file", path, "error", err)
+		return previous
+	}
+
+	return value
+}
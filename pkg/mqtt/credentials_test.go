@@ -0,0 +1,57 @@
+package mqtt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCredentials(t *testing.T) {
+	tmpDir := t.TempDir()
+	usernameFile := filepath.Join(tmpDir, "username")
+	passwordFile := filepath.Join(tmpDir, "password")
+
+	err := os.WriteFile(usernameFile, []byte("fake-user\n"), 0600)
+	require.NoError(t, err)
+	err = os.WriteFile(passwordFile, []byte("fake-password\n"), 0600)
+	require.NoError(t, err)
+
+	credentials := newFileCredentials(Options{
+		UsernameFile: usernameFile,
+		PasswordFile: passwordFile,
+		StatusClient: testNewFakeStatusClient(t),
+	})
+
+	username, password := credentials.Credentials()
+	require.Equal(t, "fake-user", username)
+	require.Equal(t, "fake-password", password)
+
+	// A rotated secret is used on the next (re)connect
+	err = os.WriteFile(passwordFile, []byte("fake-password-rotated"), 0600)
+	require.NoError(t, err)
+
+	username, password = credentials.Credentials()
+	require.Equal(t, "fake-user", username)
+	require.Equal(t, "fake-password-rotated", password)
+
+	// The previous value is kept if the file can't be read
+	err = os.Remove(passwordFile)
+	require.NoError(t, err)
+
+	username, password = credentials.Credentials()
+	require.Equal(t, "fake-user", username)
+	require.Equal(t, "fake-password-rotated", password)
+
+	// The static username is used when only the password is read from a file
+	credentials = newFileCredentials(Options{
+		Username:     "fake-static-user",
+		PasswordFile: usernameFile,
+		StatusClient: testNewFakeStatusClient(t),
+	})
+
+	username, password = credentials.Credentials()
+	require.Equal(t, "fake-static-user", username)
+	require.Equal(t, "fake-user", password)
+}
@@ -0,0 +1,47 @@
+package mqtt
+
+import (
+	"time"
+
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+)
+
+// debugState is the internal state of the client reported by /debug/state
+type debugState struct {
+	Subscriptions    map[string]int `json:"subscriptions"`
+	Paused           bool           `json:"paused"`
+	ConnectionState  string         `json:"connection_state"`
+	ReconnectCount   int            `json:"reconnect_count"`
+	InflightMessages int64          `json:"inflight_messages"`
+	PendingPackets   int            `json:"pending_packets"`
+	LastActivity     time.Time      `json:"last_activity"`
+	Brokers          []string       `json:"brokers"`
+}
+
+// DebugStateName returns the name of the client in debug state reports
+func (client *Client) DebugStateName() string {
+	return "mqtt"
+}
+
+// DebugState returns the subscriptions, connection state and queue depths of the client
+func (client *Client) DebugState() interface{} {
+	return debugState{
+		Subscriptions:    client.Subscriptions(),
+		Paused:           client.Paused(),
+		ConnectionState:  client.State().String(),
+		ReconnectCount:   client.ReconnectCount(),
+		InflightMessages: client.inflightMessages.Load(),
+		PendingPackets:   client.pendingPackets(),
+		LastActivity:     time.Unix(0, client.staleness.lastReceived.Load()).UTC(),
+		Brokers:          h.RedactURLs(client.Brokers()),
+	}
+}
+
+// pendingPackets returns the number of packets in the session store that haven't been acknowledged yet
+func (client *Client) pendingPackets() int {
+	if client.store == nil {
+		return 0
+	}
+
+	return len(client.store.All())
+}
@@ -0,0 +1,105 @@
+package mqtt
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+)
+
+// BrokerDiscoverer returns the broker URLs, implemented by the discovery package
+type BrokerDiscoverer interface {
+	Discover(ctx context.Context) ([]string, error)
+}
+
+// brokers returns the discovered brokers followed by the broker addresses from opts, mqttClientMu needs to be held
+func (client *Client) brokers(opts Options) []string {
+	brokers := make([]string, 0, len(client.discoveredBrokers)+len(opts.BrokerAddresses))
+	brokers = append(brokers, client.discoveredBrokers...)
+	brokers = append(brokers, opts.BrokerAddresses...)
+	return brokers
+}
+
+// refreshBrokers discovers the brokers, they are used by the next (re)connect (see applySettings).
+// The previous brokers are kept if the discovery fails.
+func (client *Client) refreshBrokers(ctx context.Context) {
+	if client.brokerDiscovery == nil {
+		return
+	}
+
+	brokers, err := client.brokerDiscovery.Discover(ctx)
+	if err != nil {
+		client.metrics.totalBrokerDiscoveryErrors.Inc()
+		client.statusClient.Warn("Unable to discover mqtt brokers, using the previous brokers", "brokers", h.RedactURLs(client.Brokers()), "error", err)
+		return
+	}
+
+	client.metrics.discoveredBrokers.Set(float64(len(brokers)))
+
+	client.mqttClientMu.Lock()
+	defer client.mqttClientMu.Unlock()
+
+	if slices.Equal(brokers, client.discoveredBrokers) {
+		return
+	}
+
+	// The order returned by the resolver (like the SRV priority and weight) is used to spread the clients over the brokers,
+	// a new order is applied by the next (re)connect like new brokers. Only changed brokers are logged, since the order of
+	// the A and AAAA records can change on every lookup.
+	if sameBrokers(brokers, client.discoveredBrokers) {
+		client.statusClient.Debug("Discovered mqtt brokers reordered", "brokers", brokers, "previous_brokers", client.discoveredBrokers)
+	} else {
+		client.statusClient.Info("Discovered mqtt brokers changed", "brokers", brokers, "previous_brokers", client.discoveredBrokers)
+	}
+
+	client.discoveredBrokers = brokers
+	client.settingsChanged = true
+}
+
+// sameBrokers returns true if both lists contain the same brokers, in any order
+func sameBrokers(a []string, b []string) bool {
+	sortedA := slices.Clone(a)
+	slices.Sort(sortedA)
+	sortedB := slices.Clone(b)
+	slices.Sort(sortedB)
+
+	return slices.Equal(sortedA, sortedB)
+}
+
+// applySettings replaces the paho client if the discovered brokers or the connection settings changed, it is only called
+// by connect() and reconnect() since replacing the paho client while it's connected (or connecting) would drop the connection
+func (client *Client) applySettings() {
+	client.mqttClientMu.Lock()
+	defer client.mqttClientMu.Unlock()
+
+	if !client.settingsChanged {
+		return
+	}
+
+	client.mqttClient = client.newPahoClient(client.opts)
+	client.settingsChanged = false
+}
+
+// watchBrokers discovers the brokers every interval until ctx is done, which makes new brokers available for failover
+func (client *Client) watchBrokers(ctx context.Context) {
+	ticker := time.NewTicker(client.brokerDiscoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			client.refreshBrokers(ctx)
+		}
+	}
+}
+
+// Brokers returns the brokers used by the next (re)connect, the discovered brokers first
+func (client *Client) Brokers() []string {
+	client.mqttClientMu.RLock()
+	defer client.mqttClientMu.RUnlock()
+
+	return client.brokers(client.opts)
+}
@@ -0,0 +1,90 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type testFakeDiscoverer struct {
+	brokers []string
+	err     error
+	mu      sync.Mutex
+}
+
+func (discoverer *testFakeDiscoverer) Discover(ctx context.Context) ([]string, error) {
+	discoverer.mu.Lock()
+	defer discoverer.mu.Unlock()
+
+	return discoverer.brokers, discoverer.err
+}
+
+func (discoverer *testFakeDiscoverer) set(brokers []string, err error) {
+	discoverer.mu.Lock()
+	defer discoverer.mu.Unlock()
+
+	discoverer.brokers = brokers
+	discoverer.err = err
+}
+
+func TestRefreshBrokers(t *testing.T) {
+	discoverer := &testFakeDiscoverer{}
+	opts := Options{
+		BrokerAddresses: []string{"tcp://fallback:1883"},
+		Topic:           "fake-topic",
+		ClientID:        "discovery-client",
+		BrokerDiscovery: discoverer,
+		StatusClient:    testNewFakeStatusClient(t),
+		MessageClient:   testNewFakeMessageClient(t),
+	}
+
+	client := NewClient(opts)
+	require.Equal(t, []string{"tcp://fallback:1883"}, client.Brokers())
+
+	// Discovered brokers are tried before the broker addresses
+	discoverer.set([]string{"tcp://10.0.0.1:1883", "tcp://10.0.0.2:1883"}, nil)
+	pahoClient := client.getMqttClient()
+	client.refreshBrokers(context.Background())
+	require.Equal(t, []string{"tcp://10.0.0.1:1883", "tcp://10.0.0.2:1883", "tcp://fallback:1883"}, client.Brokers())
+	require.Equal(t, float64(2), testutil.ToFloat64(client.metrics.discoveredBrokers))
+
+	// The paho client is only replaced before a (re)connect
+	require.Equal(t, pahoClient, client.getMqttClient())
+	client.applySettings()
+	require.NotEqual(t, pahoClient, client.getMqttClient())
+
+	// The paho client isn't replaced if the brokers didn't change
+	pahoClient = client.getMqttClient()
+	client.refreshBrokers(context.Background())
+	client.applySettings()
+	require.Equal(t, pahoClient, client.getMqttClient())
+
+	// The order returned by the resolver is applied by the next (re)connect
+	discoverer.set([]string{"tcp://10.0.0.2:1883", "tcp://10.0.0.1:1883"}, nil)
+	client.refreshBrokers(context.Background())
+	require.Equal(t, []string{"tcp://10.0.0.2:1883", "tcp://10.0.0.1:1883", "tcp://fallback:1883"}, client.Brokers())
+	client.applySettings()
+	require.NotEqual(t, pahoClient, client.getMqttClient())
+	require.Contains(t, testLogged(opts.StatusClient), "DEBUG Discovered mqtt brokers reordered [brokers [tcp://10.0.0.2:1883 tcp://10.0.0.1:1883] previous_brokers [tcp://10.0.0.1:1883 tcp://10.0.0.2:1883]]")
+
+	// A scaled broker is picked up
+	discoverer.set([]string{"tcp://10.0.0.1:1883", "tcp://10.0.0.2:1883", "tcp://10.0.0.3:1883"}, nil)
+	client.refreshBrokers(context.Background())
+	require.Equal(t, []string{"tcp://10.0.0.1:1883", "tcp://10.0.0.2:1883", "tcp://10.0.0.3:1883", "tcp://fallback:1883"}, client.Brokers())
+	require.Contains(t, testLogged(opts.StatusClient), "INFO Discovered mqtt brokers changed [brokers [tcp://10.0.0.1:1883 tcp://10.0.0.2:1883 tcp://10.0.0.3:1883] previous_brokers [tcp://10.0.0.2:1883 tcp://10.0.0.1:1883]]")
+
+	// The previous brokers are kept if the discovery fails
+	discoverer.set(nil, fmt.Errorf("fake no such host"))
+	client.refreshBrokers(context.Background())
+	require.Equal(t, []string{"tcp://10.0.0.1:1883", "tcp://10.0.0.2:1883", "tcp://10.0.0.3:1883", "tcp://fallback:1883"}, client.Brokers())
+	require.Equal(t, float64(1), testutil.ToFloat64(client.metrics.totalBrokerDiscoveryErrors))
+
+	// The discovered brokers are kept when the connection settings are replaced
+	opts.BrokerAddresses = []string{"tcp://new-fallback:1883"}
+	client.Reconnect(opts)
+	require.Equal(t, []string{"tcp://10.0.0.1:1883", "tcp://10.0.0.2:1883", "tcp://10.0.0.3:1883", "tcp://new-fallback:1883"}, client.Brokers())
+}
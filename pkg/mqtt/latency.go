@@ -0,0 +1,80 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// unixMillisecondsThreshold is used to tell unix timestamps in milliseconds apart from timestamps in seconds
+const unixMillisecondsThreshold = 1e11
+
+// payloadTimestamp returns the publish timestamp from a field of a JSON payload.
+// The field can be nested using dots (for example "meta.timestamp") and the value
+// can either be a RFC3339 string or a unix timestamp in seconds or milliseconds.
+// MQTT v5 message properties can't be used since the client only supports MQTT v3.1.1.
+func payloadTimestamp(payload []byte, field string) (time.Time, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to decode payload as json: %w", err)
+	}
+
+	for _, key := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return time.Time{}, fmt.Errorf("timestamp field %q not found in payload", field)
+		}
+
+		value, ok = object[key]
+		if !ok {
+			return time.Time{}, fmt.Errorf("timestamp field %q not found in payload", field)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return time.Parse(time.RFC3339Nano, v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if f > unixMillisecondsThreshold {
+			f /= 1000
+		}
+
+		seconds, fraction := math.Modf(f)
+		return time.Unix(int64(seconds), int64(fraction*1e9)), nil
+	default:
+		return time.Time{}, fmt.Errorf("timestamp field %q has unsupported type %T", field, value)
+	}
+}
+
+// observeLatency records the time between publishing (from the payload timestamp) and receiving the message
+func (client *Client) observeLatency(payload []byte, received time.Time) {
+	if client.latencyTimestampField == "" {
+		return
+	}
+
+	published, err := payloadTimestamp(payload, client.latencyTimestampField)
+	if err != nil {
+		client.metrics.totalLatencyErrors.Inc()
+		return
+	}
+
+	latency := received.Sub(published).Seconds()
+	if latency < 0 {
+		// The clocks of the publisher and the client aren't in sync
+		latency = 0
+	}
+
+	client.metrics.messageLatency.Observe(latency)
+}
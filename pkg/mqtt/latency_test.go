@@ -0,0 +1,96 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadTimestamp(t *testing.T) {
+	expected := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		testDescription     string
+		payload             string
+		field               string
+		expectedErrContains string
+	}{
+		{
+			testDescription:     "RFC3339 string",
+			payload:             `{"timestamp":"2022-10-01T12:00:00Z"}`,
+			field:               "timestamp",
+			expectedErrContains: "",
+		},
+		{
+			testDescription:     "Unix seconds",
+			payload:             `{"ts":1664625600}`,
+			field:               "ts",
+			expectedErrContains: "",
+		},
+		{
+			testDescription:     "Unix milliseconds",
+			payload:             `{"ts":1664625600000}`,
+			field:               "ts",
+			expectedErrContains: "",
+		},
+		{
+			testDescription:     "Nested field",
+			payload:             `{"meta":{"ts":"2022-10-01T12:00:00Z"}}`,
+			field:               "meta.ts",
+			expectedErrContains: "",
+		},
+		{
+			testDescription:     "Missing field",
+			payload:             `{"meta":{}}`,
+			field:               "meta.ts",
+			expectedErrContains: "timestamp field \"meta.ts\" not found in payload",
+		},
+		{
+			testDescription:     "Not json",
+			payload:             `fake message`,
+			field:               "ts",
+			expectedErrContains: "unable to decode payload as json",
+		},
+		{
+			testDescription:     "Unsupported type",
+			payload:             `{"ts":true}`,
+			field:               "ts",
+			expectedErrContains: "timestamp field \"ts\" has unsupported type bool",
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		timestamp, err := payloadTimestamp([]byte(c.payload), c.field)
+		if c.expectedErrContains != "" {
+			require.ErrorContains(t, err, c.expectedErrContains)
+			continue
+		}
+
+		require.NoError(t, err)
+		require.True(t, expected.Equal(timestamp), "expected %s but was %s", expected, timestamp)
+	}
+}
+
+func TestLatencyMetricsRegistration(t *testing.T) {
+	for _, latencyEnabled := range []bool{false, true} {
+		t.Logf("Test latency enabled: %t", latencyEnabled)
+
+		registry := prometheus.NewRegistry()
+		newClientMetrics(registry, latencyEnabled)
+
+		metricFamilies, err := registry.Gather()
+		require.NoError(t, err)
+
+		names := map[string]bool{}
+		for _, metricFamily := range metricFamilies {
+			names[metricFamily.GetName()] = true
+		}
+
+		require.True(t, names["mqtt_client_total_messages"])
+		require.Equal(t, latencyEnabled, names["mqtt_client_message_latency_seconds"])
+	}
+}
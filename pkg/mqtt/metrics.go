@@ -5,28 +5,161 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-var (
-	// metricsConnectionState shows the connection state of the MQTT client
-	metricsConnectionState = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "mqtt_client_connection_state",
-		Help: "Connection state of the MQTT client",
-	})
-
-	// metricsTotalMessages shows the total number of messages since start
-	metricsTotalMessages = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "mqtt_client_total_messages",
-		Help: "Total number of messages handled by the MQTT client",
-	})
-
-	// metricsCurrentReconnectAttempts shows the current number of reconnect attempts
-	metricsCurrentReconnectAttempts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "mqtt_client_current_reconnect_attempts",
-		Help: "Current number of reconnect attempts by the MQTT client",
-	})
-
-	// metricsTotalReconnectAttempts shows the total number of reconnect attempts
-	metricsTotalReconnectAttempts = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "mqtt_client_total_reconnect_attempts",
-		Help: "Total number of reconnect attempts by the MQTT client",
-	})
-)
+// clientMetrics contains the metrics of the MQTT client
+type clientMetrics struct {
+	// connectionState shows the connection state of the MQTT client, the current state is set to 1 and all others to 0
+	connectionState *prometheus.GaugeVec
+
+	// totalMessages shows the total number of messages since start
+	totalMessages prometheus.Counter
+
+	// totalTopicMessages shows the total number of messages since start per topic (label)
+	totalTopicMessages *prometheus.CounterVec
+
+	// totalTopicPayloadBytes shows the total number of payload bytes since start per topic (label)
+	totalTopicPayloadBytes *prometheus.CounterVec
+
+	// messagePayloadBytes shows the distribution of message payload sizes
+	messagePayloadBytes prometheus.Histogram
+
+	// lastMessageReceived shows when the last message was received per subscription
+	lastMessageReceived *prometheus.GaugeVec
+
+	// messageLatency shows the distribution of the time between a message being published and received
+	messageLatency prometheus.Histogram
+
+	// totalLatencyErrors shows the total number of messages where the publish timestamp couldn't be read
+	totalLatencyErrors prometheus.Counter
+
+	// stale shows if no messages have been received within the staleness threshold per subscription
+	stale *prometheus.GaugeVec
+
+	// totalRetainedMessages shows the total number of retained messages received since start
+	totalRetainedMessages prometheus.Counter
+
+	// totalSkippedRetainedMessages shows the total number of retained messages not printed because of the retained messages policy
+	totalSkippedRetainedMessages prometheus.Counter
+
+	// totalMessageErrors shows the total number of messages that couldn't be written since start
+	totalMessageErrors prometheus.Counter
+
+	// subscriptionGrantedQoS shows the QoS granted by the broker per subscription
+	subscriptionGrantedQoS *prometheus.GaugeVec
+
+	// totalSubscriptionDowngrades shows the total number of subscriptions granted with a lower QoS than requested
+	totalSubscriptionDowngrades prometheus.Counter
+
+	// sessionStoreRecoveredPackets shows the number of in-flight packets found in the session store at start
+	sessionStoreRecoveredPackets prometheus.Gauge
+
+	// connectAttempts shows the total number of initial connection attempts
+	connectAttempts prometheus.Counter
+
+	// currentReconnectAttempts shows the current number of reconnect attempts
+	currentReconnectAttempts prometheus.Gauge
+
+	// totalReconnectAttempts shows the total number of reconnect attempts
+	totalReconnectAttempts prometheus.Counter
+
+	// discoveredBrokers shows the number of brokers found by the last successful broker discovery
+	discoveredBrokers prometheus.Gauge
+
+	// totalBrokerDiscoveryErrors shows the total number of failed broker discoveries
+	totalBrokerDiscoveryErrors prometheus.Counter
+}
+
+// newClientMetrics creates the metrics of the MQTT client and registers them with the registerer (if not nil).
+// The latency metrics are only registered when latency tracking is enabled.
+func newClientMetrics(registerer prometheus.Registerer, latencyEnabled bool) *clientMetrics {
+	factory := promauto.With(registerer)
+
+	latencyFactory := promauto.With(nil)
+	if latencyEnabled {
+		latencyFactory = factory
+	}
+
+	return &clientMetrics{
+		connectionState: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mqtt_client_connection_state",
+			Help: "Connection state of the MQTT client (1 for the current state)",
+		}, []string{"state"}),
+		totalMessages: factory.NewCounter(prometheus.CounterOpts{
+			Name: "mqtt_client_total_messages",
+			Help: "Total number of messages handled by the MQTT client",
+		}),
+		totalTopicMessages: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "mqtt_client_total_topic_messages",
+			Help: "Total number of messages handled by the MQTT client per topic",
+		}, []string{"topic"}),
+		totalTopicPayloadBytes: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "mqtt_client_total_topic_payload_bytes",
+			Help: "Total number of payload bytes handled by the MQTT client per topic",
+		}, []string{"topic"}),
+		messagePayloadBytes: factory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "mqtt_client_message_payload_bytes",
+			Help:    "Size of the message payloads handled by the MQTT client",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+		}),
+		lastMessageReceived: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mqtt_client_last_message_received_timestamp_seconds",
+			Help: "Unix timestamp of the last message received by the MQTT client per subscription",
+		}, []string{"subscription"}),
+		messageLatency: latencyFactory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "mqtt_client_message_latency_seconds",
+			Help:    "Time between a message being published (timestamp in the payload) and received by the MQTT client",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300},
+		}),
+		totalLatencyErrors: latencyFactory.NewCounter(prometheus.CounterOpts{
+			Name: "mqtt_client_total_latency_errors",
+			Help: "Total number of messages where the MQTT client was unable to read the publish timestamp from the payload",
+		}),
+		stale: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mqtt_client_stale",
+			Help: "Set to 1 if the MQTT client hasn't received any messages within the staleness threshold per subscription",
+		}, []string{"subscription"}),
+		totalRetainedMessages: factory.NewCounter(prometheus.CounterOpts{
+			Name: "mqtt_client_total_retained_messages",
+			Help: "Total number of retained messages received by the MQTT client",
+		}),
+		totalSkippedRetainedMessages: factory.NewCounter(prometheus.CounterOpts{
+			Name: "mqtt_client_total_skipped_retained_messages",
+			Help: "Total number of retained messages the MQTT client didn't print because of the retained messages policy",
+		}),
+		totalMessageErrors: factory.NewCounter(prometheus.CounterOpts{
+			Name: "mqtt_client_total_message_errors",
+			Help: "Total number of messages the MQTT client was unable to output (and therefore not acknowledged)",
+		}),
+		subscriptionGrantedQoS: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mqtt_client_subscription_granted_qos",
+			Help: "QoS granted by the broker per subscription of the MQTT client",
+		}, []string{"topic"}),
+		totalSubscriptionDowngrades: factory.NewCounter(prometheus.CounterOpts{
+			Name: "mqtt_client_total_subscription_downgrades",
+			Help: "Total number of subscriptions where the broker granted a lower QoS than requested by the MQTT client",
+		}),
+		sessionStoreRecoveredPackets: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "mqtt_client_session_store_recovered_packets",
+			Help: "Number of in-flight packets recovered from the session store of the MQTT client at start",
+		}),
+		connectAttempts: factory.NewCounter(prometheus.CounterOpts{
+			Name: "mqtt_client_connect_attempts",
+			Help: "Total number of initial connection attempts by the MQTT client",
+		}),
+		currentReconnectAttempts: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "mqtt_client_current_reconnect_attempts",
+			Help: "Current number of reconnect attempts by the MQTT client",
+		}),
+		totalReconnectAttempts: factory.NewCounter(prometheus.CounterOpts{
+			Name: "mqtt_client_total_reconnect_attempts",
+			Help: "Total number of reconnect attempts by the MQTT client",
+		}),
+		discoveredBrokers: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "mqtt_client_discovered_brokers",
+			Help: "Number of brokers found by the last successful broker discovery of the MQTT client",
+		}),
+		totalBrokerDiscoveryErrors: factory.NewCounter(prometheus.CounterOpts{
+			Name: "mqtt_client_total_broker_discovery_errors",
+			Help: "Total number of failed broker discoveries by the MQTT client",
+		}),
+	}
+}
@@ -2,11 +2,19 @@ package mqtt
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/prometheus/client_golang/prometheus"
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
 	"github.com/xenitab/mqtt-log-stdout/pkg/message"
 	"github.com/xenitab/mqtt-log-stdout/pkg/status"
 )
@@ -19,44 +27,183 @@ type Options struct {
 	ClientID        string
 	Username        string
 	Password        string
-	CleanSession    bool
-	KeepAlive       time.Duration
-	ConnectTimeout  time.Duration
-	StatusClient    status.Client
-	MessageClient   message.Client
+	// UsernameFile and PasswordFile are read on every (re)connect when set, instead of using Username and Password
+	UsernameFile string
+	PasswordFile string
+	// CredentialsProvider is called on every (re)connect when set, instead of using the username and password (files)
+	CredentialsProvider CredentialsProvider
+	// TLSCAFile replaces the system CAs to verify the broker, the client certificate (TLSCertFile and TLSKeyFile) is read on every (re)connect
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSALPNProtocols are sent in the TLS handshake, like x-amzn-mqtt-ca for AWS IoT Core on port 443
+	TLSALPNProtocols      []string
+	TLSInsecureSkipVerify bool
+	CleanSession          bool
+	// SessionStoreDirectory enables a file backed session store in a sub directory (named after the Client ID) when set
+	SessionStoreDirectory string
+	KeepAlive             time.Duration
+	ConnectTimeout        time.Duration
+	// ConnectRetry retries the initial connection (using the reconnect backoff) instead of failing on the first error
+	ConnectRetry bool
+	// ConnectRetryDeadline is the maximum time to retry the initial connection (0 = no deadline)
+	ConnectRetryDeadline time.Duration
+	// ReconnectInitialInterval is the wait before the first reconnect attempt, doubled for every following attempt
+	ReconnectInitialInterval time.Duration
+	ReconnectMaxInterval     time.Duration
+	// ReconnectJitter is the fraction (0-1) of the reconnect interval that is randomized
+	ReconnectJitter float64
+	// ReconnectMaxAttempts stops the client after the number of failed reconnect attempts (0 = unlimited)
+	ReconnectMaxAttempts int
+	// MetricsTopicDepth is the number of topic levels used for the per topic metrics (0 = the full topic)
+	MetricsTopicDepth int
+	// MetricsTopicMaxLabels is the max number of topic labels (100 if 0), the rest is reported as "__other__"
+	MetricsTopicMaxLabels int
+	// LatencyTimestampField is the (dot separated) JSON field in the payload with the publish timestamp, used for the latency metric when set
+	LatencyTimestampField string
+	// StalenessThreshold is how long a subscription (topic filter) can be silent before a warning is printed (0 = disabled)
+	StalenessThreshold time.Duration
+	// BrokerDiscovery returns brokers that are tried before BrokerAddresses, it is called before every (re)connect attempt
+	BrokerDiscovery BrokerDiscoverer
+	// BrokerDiscoveryInterval is how often the brokers are discovered while connected (0 = only when connecting)
+	BrokerDiscoveryInterval time.Duration
+	// WillTopic enables the last will, published by the broker when the connection is lost, and the presence messages
+	WillTopic string
+	// WillPayload is the last will message, a JSON presence message with the offline status is used if empty
+	WillPayload  string
+	WillQoS      int
+	WillRetained bool
+	// PresenceMessages publishes a birth (online) message after connecting and an offline message when stopping to the will topic
+	PresenceMessages bool
+	// Version is included in the presence messages
+	Version string
+	// RetainedMessages is the policy for retained messages: RetainedPrint (default if empty), RetainedSkip or RetainedFirstConnect
+	RetainedMessages string
+	// MessageEnvelope prints the messages in a JSON envelope with the topic, retained flag and received timestamp
+	MessageEnvelope bool
+	// MessageObservers receive all messages before they are printed (also when paused), they can't block
+	MessageObservers []MessageObserver
+	// Registerer is used to register the client metrics, they aren't registered if nil
+	Registerer    prometheus.Registerer
+	StatusClient  status.Client
+	MessageClient message.Client
+}
+
+// MessageObserver is implemented by components that receive all messages, like the tail endpoint
+type MessageObserver interface {
+	// Observe is called for every received message and needs to return without blocking
+	Observe(topic string, payload []byte, received time.Time)
 }
 
 // Client contains the mqtt client struct
 type Client struct {
-	topic          string
-	qos            int
-	connected      bool
-	reconnectCount int
-	reconnectMu    sync.Mutex
-	statusClient   status.Client
-	messageClient  message.Client
-	mqttClient     pahomqtt.Client
-	ctxCancel      context.CancelFunc
-	ctxError       error
+	// topic is the topic from the options, replaced by SetTopic()
+	topic                 atomic.Value
+	qos                   int
+	subscriptions         map[string]int
+	subscriptionsMu       sync.Mutex
+	paused                atomic.Bool
+	metrics               *clientMetrics
+	state                 *connectionStateTracker
+	reconnectCount        int
+	reconnectMu           sync.Mutex
+	reconnectBackoff      backoff
+	reconnectMaxAttempts  int
+	connectRetry          bool
+	connectRetryDeadline  time.Duration
+	connectionLost        chan error
+	topicLabeler          *topicLabeler
+	latencyTimestampField string
+	staleness             *stalenessTracker
+	messageObservers      []MessageObserver
+	presence              presence
+	retainedMessages      string
+	messageEnvelope       bool
+	subscribeCounts       map[string]int
+	subscribeCountsMu     sync.Mutex
+	inflightMessages      atomic.Int64
+	store                 pahomqtt.Store
+	statusClient          status.Client
+	messageClient         message.Client
+	mqttClient            pahomqtt.Client
+	mqttClientMu          sync.RWMutex
+	// opts, discoveredBrokers and settingsChanged are used to replace the paho client and guarded by mqttClientMu
+	opts                    Options
+	discoveredBrokers       []string
+	settingsChanged         bool
+	reconnectRequests       chan struct{}
+	brokerDiscovery         BrokerDiscoverer
+	brokerDiscoveryInterval time.Duration
+	ctxCancel               context.CancelFunc
+	ctxError                error
+	ctxErrorMu              sync.Mutex
 }
 
 // NewClient returns a mqtt client
 func NewClient(opts Options) *Client {
+	clientMetrics := newClientMetrics(opts.Registerer, opts.LatencyTimestampField != "")
 	client := &Client{
-		topic:          opts.Topic,
-		qos:            opts.QoS,
-		connected:      false,
-		reconnectCount: 0,
-		statusClient:   opts.StatusClient,
-		messageClient:  opts.MessageClient,
+		qos:             opts.QoS,
+		subscriptions:   map[string]int{opts.Topic: opts.QoS},
+		subscribeCounts: make(map[string]int),
+		metrics:         clientMetrics,
+		state:           newConnectionStateTracker(clientMetrics.connectionState),
+		reconnectCount:  0,
+		reconnectBackoff: backoff{
+			initialInterval: opts.ReconnectInitialInterval,
+			maxInterval:     opts.ReconnectMaxInterval,
+			jitter:          opts.ReconnectJitter,
+		},
+		reconnectMaxAttempts:    opts.ReconnectMaxAttempts,
+		connectRetry:            opts.ConnectRetry,
+		connectRetryDeadline:    opts.ConnectRetryDeadline,
+		connectionLost:          make(chan error, 1),
+		reconnectRequests:       make(chan struct{}, 1),
+		topicLabeler:            newTopicLabeler(opts.MetricsTopicDepth, opts.MetricsTopicMaxLabels),
+		latencyTimestampField:   opts.LatencyTimestampField,
+		staleness:               newStalenessTracker(opts.StalenessThreshold),
+		messageObservers:        opts.MessageObservers,
+		presence:                newPresence(opts),
+		retainedMessages:        opts.RetainedMessages,
+		messageEnvelope:         opts.MessageEnvelope,
+		statusClient:            opts.StatusClient,
+		messageClient:           opts.MessageClient,
+		opts:                    opts,
+		brokerDiscovery:         opts.BrokerDiscovery,
+		brokerDiscoveryInterval: opts.BrokerDiscoveryInterval,
+	}
+
+	client.topic.Store(opts.Topic)
+
+	// The store is kept to be able to report the number of pending packets, see DebugState()
+	client.store = pahomqtt.NewMemoryStore()
+	if opts.SessionStoreDirectory != "" {
+		client.store = client.newSessionStore(opts)
 	}
 
-	connOpts := pahomqtt.NewClientOptions().SetClientID(opts.ClientID).SetCleanSession(opts.CleanSession).SetKeepAlive(opts.KeepAlive).SetConnectTimeout(opts.ConnectTimeout)
-	for _, broker := range opts.BrokerAddresses {
-		opts.StatusClient.Print(fmt.Sprintf("Adding mqtt broker: %s", broker), nil)
+	client.mqttClient = client.newPahoClient(opts)
+
+	return client
+}
+
+// newPahoClient returns a paho client using the discovered brokers and the connection settings from opts,
+// mqttClientMu needs to be held after the client has been created
+func (client *Client) newPahoClient(opts Options) pahomqtt.Client {
+	// Auto ack is disabled to make sure messages are only acknowledged after they have been written (at-least-once delivery)
+	// Auto reconnect is disabled since reconnects are handled by the client itself, see reconnect()
+	connOpts := pahomqtt.NewClientOptions().SetClientID(opts.ClientID).SetCleanSession(opts.CleanSession).SetKeepAlive(opts.KeepAlive).SetConnectTimeout(opts.ConnectTimeout).SetAutoAckDisabled(true).SetAutoReconnect(false)
+	for _, broker := range client.brokers(opts) {
+		opts.StatusClient.Info("Adding mqtt broker", "broker", h.RedactURL(broker))
 		connOpts.AddBroker(broker)
 	}
 
+	connOpts.SetStore(client.store)
+	client.presence.setWill(connOpts)
+
+	if opts.tlsEnabled() {
+		connOpts.SetTLSConfig(newTLSConfig(opts))
+	}
+
 	if opts.Username != "" {
 		connOpts.SetUsername(opts.Username)
 		if opts.Password != "" {
@@ -64,43 +211,140 @@ func NewClient(opts Options) *Client {
 		}
 	}
 
+	credentialsProvider := opts.CredentialsProvider
+	if credentialsProvider == nil && (opts.UsernameFile != "" || opts.PasswordFile != "") {
+		credentialsProvider = newFileCredentials(opts)
+	}
+
+	// The credentials provider takes precedence over the username and password (also from the broker URL)
+	if credentialsProvider != nil {
+		connOpts.SetCredentialsProvider(credentialsProvider.Credentials)
+	}
+
 	connOpts.OnConnect = client.onConnectHandler
 	connOpts.OnConnectionLost = client.connectionLostHandler
-	connOpts.OnReconnecting = client.reconnectHandler
+	connOpts.OnConnectAttempt = client.connectAttemptHandler
 
-	mqttClient := pahomqtt.NewClient(connOpts)
-	client.mqttClient = mqttClient
+	return pahomqtt.NewClient(connOpts)
+}
 
-	return client
+// getMqttClient returns the current paho client, it is replaced before a (re)connect when the settings changed (see applySettings)
+func (client *Client) getMqttClient() pahomqtt.Client {
+	client.mqttClientMu.RLock()
+	defer client.mqttClientMu.RUnlock()
+	return client.mqttClient
+}
+
+// getTopic returns the topic from the options or the latest SetTopic()
+func (client *Client) getTopic() string {
+	topic, _ := client.topic.Load().(string)
+	return topic
 }
 
-// Connected returns a bool if the MQTT client is connected or not
+// newSessionStore returns a file store and reports how many in-flight packets a previous session left behind
+func (client *Client) newSessionStore(opts Options) pahomqtt.Store {
+	storeDirectory := filepath.Join(opts.SessionStoreDirectory, opts.ClientID)
+
+	recoveredPackets, err := countStoredPackets(storeDirectory)
+	if err != nil {
+		opts.StatusClient.Warn("Unable to read session store", "directory", storeDirectory, "error", err)
+	}
+
+	client.metrics.sessionStoreRecoveredPackets.Set(float64(recoveredPackets))
+	opts.StatusClient.Info("Using file session store", "directory", storeDirectory, "recovered_packets", recoveredPackets)
+
+	if opts.CleanSession {
+		opts.StatusClient.Warn("Clean session is enabled, the session store will be reset when connecting to the mqtt broker")
+	}
+
+	return pahomqtt.NewFileStore(storeDirectory)
+}
+
+// countStoredPackets returns the number of packets persisted by the file store in the directory
+func countStoredPackets(directory string) (int, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".msg") {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Connected returns a bool if the MQTT client is connected to the broker or not (the subscription may not be granted yet)
 func (client *Client) Connected() bool {
-	return client.connected
+	switch client.State() {
+	case StateConnected, StateSubscribing, StateSubscribed:
+		return true
+	default:
+		return false
+	}
 }
 
-func (client *Client) setConnected() {
-	metricsConnectionState.Set(1)
-	client.connected = true
+// State returns the current connection state
+func (client *Client) State() ConnectionState {
+	return client.state.get()
 }
 
-func (client *Client) setDisconnected() {
-	metricsConnectionState.Set(0)
-	client.connected = false
+// SubscribeState returns a channel receiving connection state changes and a function to stop receiving them.
+// Only the latest state is kept for slow receivers.
+func (client *Client) SubscribeState() (<-chan ConnectionState, func()) {
+	return client.state.subscribe()
 }
 
-func (client *Client) incReconnectAttempt() {
+// ReconnectCount returns the number of reconnect attempts since the connection was lost
+func (client *Client) ReconnectCount() int {
 	client.reconnectMu.Lock()
+	defer client.reconnectMu.Unlock()
+	return client.reconnectCount
+}
+
+// HealthName returns the name of the mqtt client in health reports
+func (client *Client) HealthName() string {
+	return "mqtt"
+}
+
+// Health returns an error if the MQTT client isn't connected with a granted subscription
+func (client *Client) Health() error {
+	state := client.State()
+	if !client.Connected() {
+		return fmt.Errorf("not connected to mqtt broker (state: %s)", state)
+	}
+
+	if state != StateSubscribed {
+		return fmt.Errorf("subscriptions not granted (state: %s)", state)
+	}
+
+	return nil
+}
+
+func (client *Client) setState(state ConnectionState) {
+	client.state.set(state)
+}
+
+func (client *Client) incReconnectAttempt() int {
+	client.reconnectMu.Lock()
+	defer client.reconnectMu.Unlock()
 	client.reconnectCount++
-	metricsCurrentReconnectAttempts.Set(float64(client.reconnectCount))
-	metricsTotalReconnectAttempts.Inc()
-	client.reconnectMu.Unlock()
+	client.metrics.currentReconnectAttempts.Set(float64(client.reconnectCount))
+	client.metrics.totalReconnectAttempts.Inc()
+	return client.reconnectCount
 }
 
 func (client *Client) resetReconnectAttempt() {
 	client.reconnectMu.Lock()
 	client.reconnectCount = 0
-	metricsCurrentReconnectAttempts.Set(0)
+	client.metrics.currentReconnectAttempts.Set(0)
 	client.reconnectMu.Unlock()
 }
 
@@ -111,17 +355,14 @@ func (client *Client) Stop(ctx context.Context) error {
 	go func() {
 		defer close(c)
 
-		unsubToken := client.mqttClient.Unsubscribe(client.topic)
-
-		unsubMessage := fmt.Sprintf("Unsubscribed from topic: %s", client.topic)
-		if unsubToken.Error() != nil {
-			unsubMessage = fmt.Sprintf("Unable to gracefully unsubscribe from topic: %s", client.topic)
+		client.unsubscribeAll()
+		// The broker doesn't publish the last will when disconnecting, which is why the offline message is published
+		if client.Connected() {
+			client.publishPresence(client.getMqttClient(), presenceOffline, "stopped")
 		}
-
-		client.statusClient.Print(unsubMessage, unsubToken.Error())
-
-		client.mqttClient.Disconnect(250)
-		client.statusClient.Print("Disconnected from mqtt broker, stopping client", nil)
+		client.getMqttClient().Disconnect(250)
+		client.setState(StateStopped)
+		client.statusClient.Info("Disconnected from mqtt broker, stopping client")
 	}()
 
 	var err error
@@ -141,87 +382,248 @@ func (client *Client) setContext(ctx context.Context) context.Context {
 	return ctx
 }
 
+// cancel stops the client with an error, only the first error is kept
 func (client *Client) cancel(err error) {
-	client.ctxError = err
+	client.ctxErrorMu.Lock()
+	if client.ctxError == nil {
+		client.ctxError = err
+	}
+	client.ctxErrorMu.Unlock()
+
 	client.ctxCancel()
 }
 
+func (client *Client) getCtxError() error {
+	client.ctxErrorMu.Lock()
+	defer client.ctxErrorMu.Unlock()
+	return client.ctxError
+}
+
 // Start starts the MQTT client
 func (client *Client) Start(ctx context.Context) error {
 	ctx = client.setContext(ctx)
-	token := client.mqttClient.Connect()
+	err := client.connect(ctx)
+	if err != nil {
+		client.setState(StateStopped)
+		client.statusClient.Error("Unable to connect to mqtt broker", "error", err)
+		return err
+	}
 
-	<-token.Done()
-	if token.Error() != nil {
-		client.statusClient.Print("Unable to connect to mqtt broker", token.Error())
-		return token.Error()
+	if client.staleness.threshold > 0 {
+		go client.watchStaleness(ctx)
 	}
 
-	<-ctx.Done()
+	if client.brokerDiscovery != nil && client.brokerDiscoveryInterval > 0 {
+		go client.watchBrokers(ctx)
+	}
 
-	return client.ctxError
+	for {
+		select {
+		case <-ctx.Done():
+			return client.getCtxError()
+		case <-client.connectionLost:
+			err := client.reconnect(ctx)
+			if err != nil {
+				client.statusClient.Error("Giving up reconnecting to mqtt broker", "error", err)
+				client.cancel(err)
+			}
+		case <-client.reconnectRequests:
+			err := client.applyReconnect(ctx)
+			if err != nil {
+				client.statusClient.Error("Giving up reconnecting to mqtt broker", "error", err)
+				client.cancel(err)
+			}
+		}
+	}
+}
+
+// connect makes the initial connection to the broker, retrying until the deadline if connect retry is enabled
+func (client *Client) connect(ctx context.Context) error {
+	var deadline <-chan time.Time
+	if client.connectRetryDeadline > 0 {
+		timer := time.NewTimer(client.connectRetryDeadline)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for attempt := 1; ; attempt++ {
+		client.metrics.connectAttempts.Inc()
+		client.refreshBrokers(ctx)
+		client.applySettings()
+		token := client.getMqttClient().Connect()
+		<-token.Done()
+		if token.Error() == nil {
+			return nil
+		}
+
+		if !client.connectRetry {
+			return token.Error()
+		}
+
+		interval := client.reconnectBackoff.interval(attempt)
+		client.statusClient.Warn("Unable to connect to mqtt broker, retrying", "retry_in", interval.Round(time.Millisecond).String(), "attempt", attempt, "error", token.Error())
+
+		select {
+		case <-ctx.Done():
+			return client.getCtxError()
+		case <-deadline:
+			return fmt.Errorf("unable to connect to mqtt broker within %s (%d attempts): %w", client.connectRetryDeadline, attempt, token.Error())
+		case <-time.After(interval):
+		}
+	}
 }
 
-func (client *Client) messageHandler(c pahomqtt.Client, m pahomqtt.Message) {
-	metricsTotalMessages.Inc()
-	message := string(m.Payload())
-	client.messageClient.Print(message)
+// reconnect tries to connect to the broker until it succeeds, the context is done or the max attempts are reached
+func (client *Client) reconnect(ctx context.Context) error {
+	for {
+		attempt := client.incReconnectAttempt()
+		interval := client.reconnectBackoff.interval(attempt)
+		client.statusClient.Info("Reconnecting to mqtt broker", "reconnect_in", interval.Round(time.Millisecond).String(), "attempt", attempt)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+
+		client.refreshBrokers(ctx)
+		client.applySettings()
+		token := client.getMqttClient().Connect()
+		<-token.Done()
+		if token.Error() == nil {
+			return nil
+		}
+
+		client.setState(StateReconnecting)
+		client.statusClient.Warn("Unable to reconnect to mqtt broker", "attempt", attempt, "error", token.Error())
+
+		if client.reconnectMaxAttempts > 0 && attempt >= client.reconnectMaxAttempts {
+			return fmt.Errorf("unable to reconnect to mqtt broker after %d attempts: %w", attempt, token.Error())
+		}
+	}
 }
 
-func (client *Client) onConnectHandler(c pahomqtt.Client) {
-	client.statusClient.Print("Connected to mqtt broker", nil)
+// messageHandler returns the handler of the messages received for the subscription (topic filter)
+func (client *Client) messageHandler(subscription string) pahomqtt.MessageHandler {
+	return func(c pahomqtt.Client, m pahomqtt.Message) {
+		client.handleMessage(subscription, m)
+	}
+}
+
+func (client *Client) handleMessage(subscription string, m pahomqtt.Message) {
+	client.inflightMessages.Add(1)
+	defer client.inflightMessages.Add(-1)
+
+	received := time.Now()
+	client.staleness.received(subscription, received)
+	client.metrics.lastMessageReceived.WithLabelValues(subscription).Set(float64(received.UnixNano()) / 1e9)
+	client.observeLatency(m.Payload(), received)
 
-	subToken := c.Subscribe(client.topic, byte(client.qos), client.messageHandler)
+	client.metrics.totalMessages.Inc()
+	topicLabel := client.topicLabeler.label(m.Topic())
+	payloadSize := float64(len(m.Payload()))
+	client.metrics.totalTopicMessages.WithLabelValues(topicLabel).Inc()
+	client.metrics.totalTopicPayloadBytes.WithLabelValues(topicLabel).Add(payloadSize)
+	client.metrics.messagePayloadBytes.Observe(payloadSize)
 
-	<-subToken.Done()
-	if subToken.Error() != nil {
-		client.statusClient.Print(fmt.Sprintf("Unable to subscribe to topic: %s", client.topic), subToken.Error())
-		client.cancel(subToken.Error())
+	for _, observer := range client.messageObservers {
+		observer.Observe(m.Topic(), m.Payload(), received)
+	}
+
+	if m.Retained() {
+		client.metrics.totalRetainedMessages.Inc()
+	}
+
+	if client.Paused() {
+		m.Ack()
 		return
 	}
 
-	allowed := subscriptionAllowed(subToken, client.topic)
-	if !allowed {
-		err := fmt.Errorf("subscription not allowed")
-		client.statusClient.Print(fmt.Sprintf("Subscription not allowed to topic: %s", client.topic), err)
+	if client.skipRetained(subscription, m) {
+		client.metrics.totalSkippedRetainedMessages.Inc()
+		m.Ack()
+		return
+	}
+
+	output := string(m.Payload())
+	if client.messageEnvelope {
+		output = message.Envelope(m.Topic(), m.Payload(), m.Retained(), received)
+	}
+
+	err := client.messageClient.Print(output)
+	if err != nil {
+		// The message is not acknowledged, which makes the broker redeliver it when the session is resumed
+		client.metrics.totalMessageErrors.Inc()
+		client.statusClient.Error("Unable to output message", "topic", m.Topic(), "error", err)
 		client.cancel(err)
 		return
 	}
 
-	client.statusClient.Print(fmt.Sprintf("Subscription started to topic: %s", client.topic), nil)
+	m.Ack()
+}
 
-	client.setConnected()
-	if client.reconnectCount > 0 {
-		client.resetReconnectAttempt()
+func (client *Client) onConnectHandler(c pahomqtt.Client) {
+	// A (re)connect attempt made before the connection settings were replaced, it is disconnected by applyReconnect()
+	if client.replaced(c) {
+		return
 	}
+
+	client.setState(StateConnected)
+	client.statusClient.Info("Connected to mqtt broker")
+
+	// Subscriptions added or removed at runtime are kept across reconnects by subscribing to all of them
+	client.setState(StateSubscribing)
+	err := client.subscribeAll(c)
+	if err != nil {
+		if client.replaced(c) {
+			return
+		}
+
+		client.cancel(err)
+		return
+	}
+
+	client.setState(StateSubscribed)
+	client.resetReconnectAttempt()
+	client.publishPresence(c, presenceOnline, "")
 }
 
 func (client *Client) connectionLostHandler(c pahomqtt.Client, e error) {
-	client.setDisconnected()
-	client.statusClient.Print("Connection lost to mqtt broker", e)
+	if client.replaced(c) {
+		return
+	}
+
+	client.setState(StateReconnecting)
+	client.statusClient.Warn("Connection lost to mqtt broker", "error", e)
+
+	select {
+	case client.connectionLost <- e:
+	default:
+	}
 }
 
-func (client *Client) reconnectHandler(c pahomqtt.Client, co *pahomqtt.ClientOptions) {
-	// setDisconnected() isn't needed here as OnReconnecting is called as the same time as OnConnectionLost: https://github.com/eclipse/paho.mqtt.golang/blob/master/client.go#L491
-	client.incReconnectAttempt()
-	client.statusClient.Print(fmt.Sprintf("Reconnecting to mqtt broker, attempt: %d", client.reconnectCount), nil)
+func (client *Client) connectAttemptHandler(broker *url.URL, tlsCfg *tls.Config) *tls.Config {
+	client.setState(StateConnecting)
+	client.statusClient.Info("Connecting to mqtt broker", "broker", broker.Redacted())
+	return tlsCfg
 }
 
-func subscriptionAllowed(token pahomqtt.Token, topic string) bool {
+// subscriptionAllowed returns the QoS granted by the broker and if the subscription was allowed
+func subscriptionAllowed(token pahomqtt.Token, topic string) (byte, bool) {
 	subscriptionToken, ok := token.(*pahomqtt.SubscribeToken)
 	if !ok {
-		return false
+		return 0, false
 	}
 
 	result := subscriptionToken.Result()
 	res, found := result[topic]
 	if !found {
-		return false
+		return 0, false
 	}
 
 	if res >= 128 {
-		return false
+		return res, false
 	}
 
-	return true
+	return res, true
 }
@@ -1,13 +1,20 @@
 package mqtt
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
 	"testing"
 	"time"
 
 	pahomqtt "github.com/eclipse/paho.mqtt.golang"
 	hmqBroker "github.com/fhmq/hmq/broker"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
 	"github.com/xenitab/mqtt-log-stdout/pkg/message"
@@ -43,31 +50,42 @@ func TestStart(t *testing.T) {
 	messageClient := testNewFakeMessageClient(t)
 
 	opts := Options{
-		BrokerAddresses: []string{mockBroker},
-		Topic:           "fake-topic",
-		QoS:             0,
-		ClientID:        "sub-client",
-		Username:        "",
-		Password:        "",
-		CleanSession:    false,
-		KeepAlive:       time.Duration(0 * time.Second),
-		ConnectTimeout:  time.Duration(1 * time.Second),
-		StatusClient:    statusClient,
-		MessageClient:   messageClient,
+		BrokerAddresses:       []string{mockBroker},
+		Topic:                 "fake-topic",
+		QoS:                   0,
+		ClientID:              "sub-client",
+		Username:              "",
+		Password:              "",
+		CleanSession:          false,
+		KeepAlive:             time.Duration(0 * time.Second),
+		ConnectTimeout:        time.Duration(1 * time.Second),
+		MetricsTopicMaxLabels: 100,
+		WillTopic:             "fake-presence/sub-client",
+		WillRetained:          true,
+		PresenceMessages:      true,
+		Version:               "v0.0.0-fake",
+		StatusClient:          statusClient,
+		MessageClient:         messageClient,
 	}
 
 	mqttClient := NewClient(opts)
+	stateCh, unsubscribeState := mqttClient.SubscribeState()
+	defer unsubscribeState()
 
 	h.StartService(ctx, errGroup, mqttClient)
 
-	// Check that the mqtt client is connected
+	// Check that the mqtt client is subscribed
 	for start := time.Now(); time.Since(start) < 5*time.Second; {
-		if mqttClient.Connected() {
+		if mqttClient.State() == StateSubscribed {
 			break
 		}
 		time.Sleep(10 * time.Millisecond)
 	}
 
+	require.True(t, mqttClient.Connected())
+	require.NoError(t, mqttClient.Health())
+	require.Equal(t, StateSubscribed, <-stateCh)
+
 	// Publish message here
 	publishHost := fmt.Sprintf("tcp://%s", mockBroker)
 	connOpts := pahomqtt.NewClientOptions().SetClientID("pub-client").SetCleanSession(true).SetKeepAlive(opts.KeepAlive).AddBroker(publishHost)
@@ -77,6 +95,24 @@ func TestStart(t *testing.T) {
 	token.Wait()
 	require.NoError(t, token.Error())
 
+	// The retained birth message is received when subscribing to the presence topic
+	presenceMessages := make(chan presenceMessage, 10)
+	token = publishMqttClient.Subscribe(opts.WillTopic, 0, func(c pahomqtt.Client, m pahomqtt.Message) {
+		var message presenceMessage
+		err := json.Unmarshal(m.Payload(), &message)
+		require.NoError(t, err)
+		presenceMessages <- message
+	})
+	token.Wait()
+	require.NoError(t, token.Error())
+
+	birthMessage := testReceivePresence(t, presenceMessages)
+	require.Equal(t, "sub-client", birthMessage.ClientID)
+	require.Equal(t, "online", birthMessage.Status)
+	require.Equal(t, "v0.0.0-fake", birthMessage.Version)
+	require.Equal(t, []string{"fake-topic"}, birthMessage.Topics)
+	require.NotEmpty(t, birthMessage.Timestamp)
+
 	numberOfWorkers := 10
 	messagesPerWorker := 200
 	expectedMessageCount := messagesPerWorker * numberOfWorkers
@@ -102,7 +138,71 @@ func TestStart(t *testing.T) {
 	var messageCount int
 	for start := time.Now(); time.Since(start) < 5*time.Second; {
 		fakeMessageClient := messageClient.(*testFakeMessage)
-		messageCount = len(fakeMessageClient.messages)
+		messageCount = fakeMessageClient.count()
+		if messageCount == expectedMessageCount {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	require.Equal(t, expectedMessageCount, messageCount)
+
+	// Subscriptions added at runtime are subscribed to directly
+	err = mqttClient.AddSubscription("fake-topic-added/#", 0)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"fake-topic": 0, "fake-topic-added/#": 0}, mqttClient.Subscriptions())
+
+	publishToken := publishMqttClient.Publish("fake-topic-added/device", 0, false, "test message added")
+	<-publishToken.Done()
+	require.NoError(t, publishToken.Error())
+	expectedMessageCount++
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		messageCount = messageClient.(*testFakeMessage).count()
+		if messageCount == expectedMessageCount {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err = mqttClient.RemoveSubscription("fake-topic-added/#")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"fake-topic": 0}, mqttClient.Subscriptions())
+
+	// Reloading the config replaces the topic and reconnects with the new connection settings, keeping the subscriptions
+	err = mqttClient.SetTopic("fake-topic-reloaded", 0)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"fake-topic-reloaded": 0}, mqttClient.Subscriptions())
+
+	reloadedOpts := opts
+	reloadedOpts.ClientID = "sub-client-reloaded"
+	reloadedOpts.KeepAlive = 30 * time.Second
+	mqttClient.Reconnect(reloadedOpts)
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		if mqttClient.State() == StateSubscribed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, StateSubscribed, mqttClient.State())
+
+	// The in-memory broker also publishes the last will when the client disconnects before reconnecting
+	willMessage := testReceivePresence(t, presenceMessages)
+	require.Equal(t, presenceMessage{ClientID: "sub-client", Status: "offline", Reason: "connection lost", Version: "v0.0.0-fake"}, willMessage)
+
+	// A birth message is published after every (re)connect
+	birthMessage = testReceivePresence(t, presenceMessages)
+	require.Equal(t, "online", birthMessage.Status)
+	require.Equal(t, []string{"fake-topic-reloaded"}, birthMessage.Topics)
+
+	publishToken = publishMqttClient.Publish("fake-topic-reloaded", 0, false, "test message reloaded")
+	<-publishToken.Done()
+	require.NoError(t, publishToken.Error())
+	expectedMessageCount++
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		messageCount = messageClient.(*testFakeMessage).count()
 		if messageCount == expectedMessageCount {
 			break
 		}
@@ -119,7 +219,266 @@ func TestStart(t *testing.T) {
 	err = h.WaitForErrGroup(errGroup)
 	require.NoError(t, err)
 
+	// An offline message is published when stopping, since the broker doesn't publish the last will
+	offlineMessage := testReceivePresence(t, presenceMessages)
+	require.Equal(t, "offline", offlineMessage.Status)
+	require.Equal(t, "stopped", offlineMessage.Reason)
+	publishMqttClient.Disconnect(0)
+
 	require.Equal(t, expectedMessageCount, messageCount)
+	require.Equal(t, float64(expectedMessageCount-2), testutil.ToFloat64(mqttClient.metrics.totalTopicMessages.WithLabelValues(opts.Topic)))
+	require.Equal(t, StateStopped, mqttClient.State())
+	require.False(t, mqttClient.Connected())
+}
+
+// testReplaceReceived replaces the received timestamp in the envelopes, to compare the messages
+func testReplaceReceived(messages []string) []string {
+	var replaced []string
+	for _, m := range messages {
+		replaced = append(replaced, regexp.MustCompile(`"received":"[^"]*"`).ReplaceAllString(m, `"received":"<timestamp>"`))
+	}
+
+	return replaced
+}
+
+func testReceivePresence(t *testing.T, presenceMessages chan presenceMessage) presenceMessage {
+	t.Helper()
+
+	select {
+	case message := <-presenceMessages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a presence message to be received")
+		return presenceMessage{}
+	}
+}
+
+func TestMessageHandler(t *testing.T) {
+	cases := []struct {
+		testDescription  string
+		printErr         error
+		paused           bool
+		retained         bool
+		retainedMessages string
+		subscribes       int
+		envelope         bool
+		expectAck        bool
+		expectCancel     bool
+		expectOutput     []string
+		expectSkipped    float64
+	}{
+		{
+			testDescription: "Message written is acknowledged",
+			printErr:        nil,
+			expectAck:       true,
+			expectCancel:    false,
+			expectOutput:    []string{"fake message"},
+		},
+		{
+			testDescription: "Message not written isn't acknowledged",
+			printErr:        fmt.Errorf("fake error"),
+			expectAck:       false,
+			expectCancel:    true,
+		},
+		{
+			testDescription: "Message is acknowledged without being written when paused",
+			printErr:        fmt.Errorf("fake error"),
+			paused:          true,
+			expectAck:       true,
+			expectCancel:    false,
+		},
+		{
+			testDescription:  "Retained message is written with the print policy",
+			retained:         true,
+			retainedMessages: RetainedPrint,
+			subscribes:       2,
+			expectAck:        true,
+			expectOutput:     []string{"fake message"},
+		},
+		{
+			testDescription:  "Retained message is acknowledged without being written with the skip policy",
+			retained:         true,
+			retainedMessages: RetainedSkip,
+			subscribes:       1,
+			expectAck:        true,
+			expectSkipped:    1,
+		},
+		{
+			testDescription:  "Retained message is written on the first subscribe with the first-connect policy",
+			retained:         true,
+			retainedMessages: RetainedFirstConnect,
+			subscribes:       1,
+			expectAck:        true,
+			expectOutput:     []string{"fake message"},
+		},
+		{
+			testDescription:  "Retained message is acknowledged without being written after subscribing again with the first-connect policy",
+			retained:         true,
+			retainedMessages: RetainedFirstConnect,
+			subscribes:       2,
+			expectAck:        true,
+			expectSkipped:    1,
+		},
+		{
+			testDescription: "Retained message is marked in the envelope",
+			retained:        true,
+			envelope:        true,
+			expectAck:       true,
+			expectOutput:    []string{`{"topic":"fake-topic","retained":true,"received":"<timestamp>","payload":"fake message"}`},
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		messageClient := testNewFakeMessageClient(t)
+		messageClient.(*testFakeMessage).err = c.printErr
+
+		observer := &testFakeMessageObserver{}
+		client := &Client{
+			statusClient:     testNewFakeStatusClient(t),
+			messageClient:    messageClient,
+			metrics:          newClientMetrics(nil, false),
+			topicLabeler:     newTopicLabeler(0, 10),
+			staleness:        newStalenessTracker(0),
+			messageObservers: []MessageObserver{observer},
+			retainedMessages: c.retainedMessages,
+			messageEnvelope:  c.envelope,
+			subscribeCounts:  map[string]int{"+": c.subscribes},
+		}
+
+		client.paused.Store(c.paused)
+
+		ctx := client.setContext(context.Background())
+		m := &testFakeMqttMessage{
+			topic:    "fake-topic",
+			payload:  []byte("fake message"),
+			retained: c.retained,
+		}
+
+		client.handleMessage("+", m)
+
+		require.Equal(t, c.expectAck, m.acked)
+		require.Equal(t, c.expectOutput, testReplaceReceived(messageClient.(*testFakeMessage).messages))
+		require.Equal(t, c.expectSkipped, testutil.ToFloat64(client.metrics.totalSkippedRetainedMessages))
+		require.Equal(t, []string{"fake-topic"}, observer.topics)
+		// The last message received is labelled with the subscription the message was received for
+		require.Equal(t, 1, testutil.CollectAndCount(client.metrics.lastMessageReceived))
+		require.Greater(t, testutil.ToFloat64(client.metrics.lastMessageReceived.WithLabelValues("+")), float64(0))
+		require.Equal(t, c.expectCancel, ctx.Err() != nil)
+		if c.expectCancel {
+			require.ErrorIs(t, client.getCtxError(), c.printErr)
+		}
+
+		client.ctxCancel()
+	}
+}
+
+func TestReconnectMaxAttempts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedBroker := listener.Addr().String()
+	listener.Close()
+
+	opts := Options{
+		BrokerAddresses:          []string{closedBroker},
+		Topic:                    "fake-topic",
+		ClientID:                 "reconnect-client",
+		ConnectTimeout:           time.Duration(1 * time.Second),
+		ReconnectInitialInterval: time.Millisecond,
+		ReconnectMaxInterval:     10 * time.Millisecond,
+		ReconnectMaxAttempts:     3,
+		StatusClient:             testNewFakeStatusClient(t),
+		MessageClient:            testNewFakeMessageClient(t),
+	}
+
+	client := NewClient(opts)
+
+	err = client.reconnect(context.Background())
+	require.ErrorContains(t, err, "unable to reconnect to mqtt broker after 3 attempts")
+	require.Equal(t, 3, client.ReconnectCount())
+	// The broker tried is logged at the default (info) level
+	require.Contains(t, testLogged(opts.StatusClient), fmt.Sprintf("INFO Connecting to mqtt broker [broker tcp://%s]", closedBroker))
+}
+
+func TestConnectRetry(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedBroker := listener.Addr().String()
+	listener.Close()
+
+	cases := []struct {
+		testDescription     string
+		connectRetry        bool
+		expectedErrContains string
+		expectedMinAttempts int
+	}{
+		{
+			testDescription:     "Without connect retry the first error is returned",
+			connectRetry:        false,
+			expectedErrContains: "connection refused",
+			expectedMinAttempts: 1,
+		},
+		{
+			testDescription:     "With connect retry the error is returned when the deadline is reached",
+			connectRetry:        true,
+			expectedErrContains: "unable to connect to mqtt broker within 100ms",
+			expectedMinAttempts: 2,
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		opts := Options{
+			BrokerAddresses:          []string{closedBroker},
+			Topic:                    "fake-topic",
+			ClientID:                 "connect-client",
+			ConnectTimeout:           time.Duration(1 * time.Second),
+			ConnectRetry:             c.connectRetry,
+			ConnectRetryDeadline:     100 * time.Millisecond,
+			ReconnectInitialInterval: 10 * time.Millisecond,
+			ReconnectMaxInterval:     10 * time.Millisecond,
+			StatusClient:             testNewFakeStatusClient(t),
+			MessageClient:            testNewFakeMessageClient(t),
+		}
+
+		client := NewClient(opts)
+		ctx := client.setContext(context.Background())
+
+		attemptsBefore := testutil.ToFloat64(client.metrics.connectAttempts)
+		err := client.connect(ctx)
+		require.ErrorContains(t, err, c.expectedErrContains)
+		require.GreaterOrEqual(t, testutil.ToFloat64(client.metrics.connectAttempts)-attemptsBefore, float64(c.expectedMinAttempts))
+		require.False(t, client.Connected())
+
+		client.ctxCancel()
+	}
+}
+
+func TestCountStoredPackets(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	count, err := countStoredPackets(filepath.Join(tmpDir, "missing"))
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	for _, name := range []string{"o.1.msg", "i.2.msg", "o.3.tmp", "o.4.CORRUPT"} {
+		err := os.WriteFile(filepath.Join(tmpDir, name), []byte{}, 0600)
+		require.NoError(t, err)
+	}
+
+	count, err = countStoredPackets(tmpDir)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+type testFakeMessageObserver struct {
+	topics []string
+}
+
+func (observer *testFakeMessageObserver) Observe(topic string, payload []byte, received time.Time) {
+	observer.topics = append(observer.topics, topic)
 }
 
 func TestMain(m *testing.M) {
@@ -135,6 +494,7 @@ func TestMain(m *testing.M) {
 		goleak.IgnoreTopFunction("github.com/eclipse/paho%2emqtt%2egolang.(*router).matchAndDispatch.func2"),
 		goleak.IgnoreTopFunction("github.com/fhmq/hmq/pool.startWorker.func1"),
 		goleak.IgnoreTopFunction("sync.runtime_Semacquire"),
+		goleak.IgnoreTopFunction("sync.runtime_SemacquireWaitGroup"),
 		goleak.IgnoreTopFunction("internal/poll.runtime_pollWait"),
 		goleak.IgnoreTopFunction("github.com/patrickmn/go-cache.(*janitor).Run"),
 	)
@@ -143,6 +503,8 @@ func TestMain(m *testing.M) {
 type testFakeMessage struct {
 	t        *testing.T
 	messages []string
+	mu       sync.Mutex
+	err      error
 }
 
 func testNewFakeMessageClient(t *testing.T) message.Client {
@@ -154,14 +516,53 @@ func testNewFakeMessageClient(t *testing.T) message.Client {
 	}
 }
 
-func (client *testFakeMessage) Print(m string) {
+func (client *testFakeMessage) HealthName() string {
+	return "message"
+}
+
+func (client *testFakeMessage) Health() error {
+	return nil
+}
+
+func (client *testFakeMessage) Print(m string) error {
 	client.t.Helper()
 
+	if client.err != nil {
+		return client.err
+	}
+
+	client.mu.Lock()
 	client.messages = append(client.messages, m)
+	client.mu.Unlock()
+
+	return nil
+}
+
+func (client *testFakeMessage) count() int {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return len(client.messages)
 }
 
+type testFakeMqttMessage struct {
+	topic    string
+	payload  []byte
+	retained bool
+	acked    bool
+}
+
+func (m *testFakeMqttMessage) Duplicate() bool   { return false }
+func (m *testFakeMqttMessage) Qos() byte         { return 1 }
+func (m *testFakeMqttMessage) Retained() bool    { return m.retained }
+func (m *testFakeMqttMessage) Topic() string     { return m.topic }
+func (m *testFakeMqttMessage) MessageID() uint16 { return 0 }
+func (m *testFakeMqttMessage) Payload() []byte   { return m.payload }
+func (m *testFakeMqttMessage) Ack()              { m.acked = true }
+
 type testFakeStatus struct {
-	t *testing.T
+	t    *testing.T
+	logs []string
+	mu   sync.Mutex
 }
 
 func testNewFakeStatusClient(t *testing.T) status.Client {
@@ -172,6 +573,38 @@ func testNewFakeStatusClient(t *testing.T) status.Client {
 	}
 }
 
-func (s *testFakeStatus) Print(m string, e error) {
+func (s *testFakeStatus) Debug(m string, args ...any) {
 	s.t.Helper()
+	s.log("DEBUG", m, args...)
+}
+
+func (s *testFakeStatus) Info(m string, args ...any) {
+	s.t.Helper()
+	s.log("INFO", m, args...)
+}
+
+func (s *testFakeStatus) Warn(m string, args ...any) {
+	s.t.Helper()
+	s.log("WARN", m, args...)
+}
+
+func (s *testFakeStatus) Error(m string, args ...any) {
+	s.t.Helper()
+	s.log("ERROR", m, args...)
+}
+
+func (s *testFakeStatus) log(level string, m string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logs = append(s.logs, fmt.Sprintf("%s %s %v", level, m, args))
+}
+
+// testLogged returns the status messages logged with the fake status client
+func testLogged(statusClient status.Client) []string {
+	s := statusClient.(*testFakeStatus)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.logs...)
 }
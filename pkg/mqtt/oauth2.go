@@ -0,0 +1,188 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+	"github.com/xenitab/mqtt-log-stdout/pkg/status"
+)
+
+// OAuth2Options takes the input configuration for the OAuth2 client credentials provider
+type OAuth2Options struct {
+	// TokenURL is the token endpoint of the OAuth2 server
+	TokenURL string
+	ClientID string
+	// ClientSecretFile is read on every token request when set, instead of using ClientSecret
+	ClientSecret     string
+	ClientSecretFile string
+	Scopes           []string
+	// Audience is added to the token request when set, required by some servers to issue a JWT
+	Audience string
+	// Username is sent together with the token (used as the password), the client ID is used if empty
+	Username string
+	// RefreshBefore is how long before the expiry a new token is requested
+	RefreshBefore time.Duration
+	// Timeout is the max duration of a token request, 10 seconds is used if 0
+	Timeout time.Duration
+	// HTTPClient is used for the token requests, http.DefaultClient is used if nil
+	HTTPClient   *http.Client
+	StatusClient status.Client
+}
+
+// OAuth2Credentials is a CredentialsProvider using an OAuth2 client credentials token as the password.
+// The token is cached and a new one is requested when it expires within the refresh before duration.
+type OAuth2Credentials struct {
+	opts   OAuth2Options
+	token  string
+	expiry time.Time
+	now    func() time.Time
+	mu     sync.Mutex
+}
+
+// tokenResponse is the response from the token endpoint (RFC 6749 section 5.1)
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// NewOAuth2Credentials returns an OAuth2 client credentials provider
+func NewOAuth2Credentials(opts OAuth2Options) *OAuth2Credentials {
+	if opts.Username == "" {
+		opts.Username = opts.ClientID
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+
+	return &OAuth2Credentials{
+		opts: opts,
+		now:  time.Now,
+	}
+}
+
+// Credentials returns the username and a valid token, the previous token is used if a new one can't be requested
+func (c *OAuth2Credentials) Credentials() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && c.now().Add(c.opts.RefreshBefore).Before(c.expiry) {
+		return c.opts.Username, c.token
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+
+	token, expiry, err := c.requestToken(ctx)
+	if err != nil {
+		c.opts.StatusClient.Warn("Unable to request mqtt OAuth2 token, using the previous token", "token_url", c.opts.TokenURL, "expiry", c.expiry, "error", err)
+		return c.opts.Username, c.token
+	}
+
+	c.opts.StatusClient.Debug("Requested mqtt OAuth2 token", "token_url", c.opts.TokenURL, "expiry", expiry)
+	c.token = token
+	c.expiry = expiry
+
+	return c.opts.Username, c.token
+}
+
+// requestToken returns the access token and when it expires, a zero expiry means that a new token is requested on every connect
+func (c *OAuth2Credentials) requestToken(ctx context.Context) (string, time.Time, error) {
+	clientSecret := c.opts.ClientSecret
+	if c.opts.ClientSecretFile != "" {
+		var err error
+		clientSecret, err = h.ReadSecretFile(c.opts.ClientSecretFile)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(c.opts.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.opts.Scopes, " "))
+	}
+
+	if c.opts.Audience != "" {
+		form.Set("audience", c.opts.Audience)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.opts.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.opts.ClientID), url.QueryEscape(clientSecret))
+
+	requested := c.now()
+	res, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("token endpoint returned %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	var tokenRes tokenResponse
+	err = json.Unmarshal(body, &tokenRes)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to parse token response: %w", err)
+	}
+
+	if tokenRes.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("token response doesn't contain an access token")
+	}
+
+	if tokenRes.ExpiresIn > 0 {
+		return tokenRes.AccessToken, requested.Add(time.Duration(tokenRes.ExpiresIn) * time.Second), nil
+	}
+
+	return tokenRes.AccessToken, jwtExpiry(tokenRes.AccessToken), nil
+}
+
+// jwtExpiry returns the exp claim of a JWT without verifying it, a zero time is returned if the token isn't a JWT or doesn't expire
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+
+	err = json.Unmarshal(payload, &claims)
+	if err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,149 @@
+package mqtt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testFakeTokenServer struct {
+	requests  int
+	expiresIn int64
+	fail      bool
+	form      map[string]string
+	mu        sync.Mutex
+}
+
+func (server *testFakeTokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != "fake-client" || clientSecret != "fake-secret" {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if server.fail {
+		http.Error(w, `{"error":"temporarily_unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server.form = map[string]string{}
+	for key := range r.PostForm {
+		server.form[key] = r.PostForm.Get(key)
+	}
+
+	server.requests++
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"access_token":"fake-token-%d","token_type":"Bearer","expires_in":%d}`, server.requests, server.expiresIn)
+}
+
+func (server *testFakeTokenServer) set(expiresIn int64, fail bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.expiresIn = expiresIn
+	server.fail = fail
+}
+
+func TestOAuth2Credentials(t *testing.T) {
+	tokenServer := &testFakeTokenServer{expiresIn: 300}
+	httpServer := httptest.NewServer(tokenServer)
+	defer httpServer.Close()
+
+	credentials := NewOAuth2Credentials(OAuth2Options{
+		TokenURL:      httpServer.URL,
+		ClientID:      "fake-client",
+		ClientSecret:  "fake-secret",
+		Scopes:        []string{"mqtt:read", "mqtt:subscribe"},
+		Audience:      "fake-audience",
+		RefreshBefore: 60 * time.Second,
+		StatusClient:  testNewFakeStatusClient(t),
+	})
+
+	now := time.Now()
+	credentials.now = func() time.Time { return now }
+
+	username, password := credentials.Credentials()
+	require.Equal(t, "fake-client", username)
+	require.Equal(t, "fake-token-1", password)
+	require.Equal(t, map[string]string{"grant_type": "client_credentials", "scope": "mqtt:read mqtt:subscribe", "audience": "fake-audience"}, tokenServer.form)
+
+	// The token is cached until it expires within the refresh before duration
+	now = now.Add(239 * time.Second)
+	_, password = credentials.Credentials()
+	require.Equal(t, "fake-token-1", password)
+
+	now = now.Add(1 * time.Second)
+	_, password = credentials.Credentials()
+	require.Equal(t, "fake-token-2", password)
+
+	// The previous token is used if a new one can't be requested
+	tokenServer.set(300, true)
+	now = now.Add(300 * time.Second)
+	_, password = credentials.Credentials()
+	require.Equal(t, "fake-token-2", password)
+
+	// A new token is requested on every connect if it doesn't expire
+	tokenServer.set(0, false)
+	_, password = credentials.Credentials()
+	require.Equal(t, "fake-token-3", password)
+	_, password = credentials.Credentials()
+	require.Equal(t, "fake-token-4", password)
+}
+
+func TestOAuth2CredentialsSecretFile(t *testing.T) {
+	tokenServer := &testFakeTokenServer{expiresIn: 300}
+	httpServer := httptest.NewServer(tokenServer)
+	defer httpServer.Close()
+
+	secretFile := filepath.Join(t.TempDir(), "client-secret")
+	err := os.WriteFile(secretFile, []byte("fake-secret\n"), 0600)
+	require.NoError(t, err)
+
+	credentials := NewOAuth2Credentials(OAuth2Options{
+		TokenURL:         httpServer.URL,
+		ClientID:         "fake-client",
+		ClientSecretFile: secretFile,
+		Username:         "fake-user",
+		StatusClient:     testNewFakeStatusClient(t),
+	})
+
+	username, password := credentials.Credentials()
+	require.Equal(t, "fake-user", username)
+	require.Equal(t, "fake-token-1", password)
+
+	// An invalid client secret doesn't return a token
+	credentials = NewOAuth2Credentials(OAuth2Options{
+		TokenURL:     httpServer.URL,
+		ClientID:     "fake-client",
+		ClientSecret: "wrong-secret",
+		StatusClient: testNewFakeStatusClient(t),
+	})
+
+	_, password = credentials.Credentials()
+	require.Equal(t, "", password)
+}
+
+func TestJWTExpiry(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"fake","exp":1700000000}`))
+
+	require.Equal(t, time.Unix(1700000000, 0), jwtExpiry(fmt.Sprintf("header.%s.signature", payload)))
+	require.True(t, jwtExpiry("opaque-token").IsZero())
+	require.True(t, jwtExpiry("header.not-base64!.signature").IsZero())
+}
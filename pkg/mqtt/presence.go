@@ -0,0 +1,117 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	presenceOnline  = "online"
+	presenceOffline = "offline"
+)
+
+// presencePublishTimeout is the max time to wait for the birth and offline messages to be published
+const presencePublishTimeout = 1 * time.Second
+
+// presence publishes the birth (online) message after connecting and the offline message when stopping to the will topic
+type presence struct {
+	clientID    string
+	version     string
+	topic       string
+	qos         byte
+	retained    bool
+	willPayload string
+	messages    bool
+}
+
+// presenceMessage is the payload of the birth, offline and default last will messages
+type presenceMessage struct {
+	ClientID  string   `json:"client_id"`
+	Status    string   `json:"status"`
+	Reason    string   `json:"reason,omitempty"`
+	Version   string   `json:"version,omitempty"`
+	Topics    []string `json:"topics,omitempty"`
+	Timestamp string   `json:"timestamp,omitempty"`
+}
+
+func newPresence(opts Options) presence {
+	p := presence{
+		clientID:    opts.ClientID,
+		version:     opts.Version,
+		topic:       opts.WillTopic,
+		qos:         byte(opts.WillQoS),
+		retained:    opts.WillRetained,
+		willPayload: opts.WillPayload,
+		messages:    opts.PresenceMessages,
+	}
+
+	if p.willPayload == "" {
+		// The will is sent when connecting, which is why it doesn't have a timestamp
+		p.willPayload = p.payload(presenceOffline, "connection lost", nil, time.Time{})
+	}
+
+	return p
+}
+
+func (p presence) enabled() bool {
+	return p.topic != ""
+}
+
+func (p presence) payload(status string, reason string, topics []string, timestamp time.Time) string {
+	message := presenceMessage{
+		ClientID: p.clientID,
+		Status:   status,
+		Reason:   reason,
+		Version:  p.version,
+		Topics:   topics,
+	}
+
+	if !timestamp.IsZero() {
+		message.Timestamp = timestamp.UTC().Format(time.RFC3339Nano)
+	}
+
+	// The message only contains strings, which can't fail to marshal
+	b, _ := json.Marshal(message)
+	return string(b)
+}
+
+// setWill configures the last will, published by the broker when the connection is lost without disconnecting
+func (p presence) setWill(connOpts *pahomqtt.ClientOptions) {
+	if !p.enabled() {
+		return
+	}
+
+	connOpts.SetWill(p.topic, p.willPayload, p.qos, p.retained)
+}
+
+// publishPresence publishes the birth or offline message, errors are logged since they shouldn't stop the client
+func (client *Client) publishPresence(c pahomqtt.Client, status string, reason string) {
+	if !client.presence.enabled() || !client.presence.messages {
+		return
+	}
+
+	var topics []string
+	if status == presenceOnline {
+		for topic := range client.Subscriptions() {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+	}
+
+	payload := client.presence.payload(status, reason, topics, time.Now())
+	token := c.Publish(client.presence.topic, client.presence.qos, client.presence.retained, payload)
+	if !token.WaitTimeout(presencePublishTimeout) {
+		client.statusClient.Warn("Timed out publishing presence message", "topic", client.presence.topic, "status", status)
+		return
+	}
+
+	if token.Error() != nil {
+		client.statusClient.Warn("Unable to publish presence message", "topic", client.presence.topic, "status", status, "error", token.Error())
+		return
+	}
+
+	client.statusClient.Debug("Presence message published", "topic", client.presence.topic, "status", status)
+}
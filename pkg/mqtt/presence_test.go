@@ -0,0 +1,41 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresence(t *testing.T) {
+	p := newPresence(Options{ClientID: "fake-client", Version: "v1.0.0"})
+	require.False(t, p.enabled())
+
+	connOpts := pahomqtt.NewClientOptions()
+	p.setWill(connOpts)
+	require.False(t, connOpts.WillEnabled)
+
+	p = newPresence(Options{
+		ClientID:     "fake-client",
+		Version:      "v1.0.0",
+		WillTopic:    "presence/fake-client",
+		WillQoS:      1,
+		WillRetained: true,
+	})
+	require.True(t, p.enabled())
+	require.Equal(t, `{"client_id":"fake-client","status":"offline","reason":"connection lost","version":"v1.0.0"}`, p.willPayload)
+
+	p.setWill(connOpts)
+	require.True(t, connOpts.WillEnabled)
+	require.Equal(t, "presence/fake-client", connOpts.WillTopic)
+	require.Equal(t, byte(1), connOpts.WillQos)
+	require.True(t, connOpts.WillRetained)
+
+	timestamp := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.Equal(t, `{"client_id":"fake-client","status":"online","version":"v1.0.0","topics":["a/#","b/#"],"timestamp":"2024-01-02T03:04:05Z"}`, p.payload(presenceOnline, "", []string{"a/#", "b/#"}, timestamp))
+
+	// A custom will payload is used as is
+	p = newPresence(Options{WillTopic: "presence/fake-client", WillPayload: "offline"})
+	require.Equal(t, "offline", p.willPayload)
+}
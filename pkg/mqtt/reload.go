@@ -0,0 +1,83 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+)
+
+// SetTopic replaces the subscription of the topic from the options (or the previous SetTopic()) with topic,
+// subscriptions added with AddSubscription() are kept. The new topic is subscribed to before the old one is removed.
+func (client *Client) SetTopic(topic string, qos int) error {
+	oldTopic := client.getTopic()
+
+	err := client.AddSubscription(topic, qos)
+	if err != nil {
+		return err
+	}
+
+	client.topic.Store(topic)
+
+	if topic == oldTopic {
+		return nil
+	}
+
+	// The old topic may already have been removed using the admin API
+	err = client.RemoveSubscription(oldTopic)
+	if err != nil && !errors.Is(err, h.ErrSubscriptionNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// Reconnect replaces the connection settings (broker addresses (the discovered brokers are kept), client ID, username, password, clean session,
+// keep alive and connect timeout) with the ones from opts and reconnects if connected, the other options are ignored.
+// The subscriptions are kept and the reconnect uses the reconnect backoff.
+//
+// The paho client is only replaced by the (re)connect loop in Start(), a (re)connect attempt that is already running
+// uses the previous settings and is disconnected again if it succeeds.
+func (client *Client) Reconnect(opts Options) {
+	client.mqttClientMu.Lock()
+	client.opts = opts
+	client.settingsChanged = true
+	client.mqttClientMu.Unlock()
+
+	select {
+	case client.reconnectRequests <- struct{}{}:
+	default:
+	}
+}
+
+// applyReconnect disconnects the paho client and reconnects with the new connection settings, unless they were already
+// applied by a reconnect after the connection was lost
+func (client *Client) applyReconnect(ctx context.Context) error {
+	client.mqttClientMu.RLock()
+	settingsChanged := client.settingsChanged
+	client.mqttClientMu.RUnlock()
+
+	if !settingsChanged {
+		return nil
+	}
+
+	// Disconnect() doesn't call the connection lost handler, a connection lost before the disconnect is handled by this reconnect
+	oldClient := client.getMqttClient()
+	client.applySettings()
+	oldClient.Disconnect(250)
+	client.setState(StateReconnecting)
+	client.statusClient.Info("Reconnecting to mqtt broker to apply new connection settings")
+
+	select {
+	case <-client.connectionLost:
+	default:
+	}
+
+	return client.reconnect(ctx)
+}
+
+// replaced returns true if c isn't the current paho client, the handlers of a replaced client are ignored
+func (client *Client) replaced(c pahomqtt.Client) bool {
+	return c != client.getMqttClient()
+}
@@ -0,0 +1,72 @@
+package mqtt
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+)
+
+func TestReconnectDuringConnect(t *testing.T) {
+	errGroup, ctx, cancel := h.NewErrGroupAndContext()
+	defer cancel()
+
+	// The previous broker only acknowledges the connection after the connection settings have been replaced
+	connecting := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var previousClosed atomic.Bool
+	previousBroker := testStartFakeBroker(t, func(conn net.Conn) {
+		connecting <- struct{}{}
+		<-release
+		testServeFakeBroker(conn, nil)
+		previousClosed.Store(true)
+	})
+	newBroker := testNewFakeBroker(t, nil)
+
+	opts := Options{
+		BrokerAddresses:          []string{previousBroker},
+		Topic:                    "fake-topic",
+		QoS:                      1,
+		ClientID:                 "reconnect-during-connect-client",
+		ConnectTimeout:           5 * time.Second,
+		ReconnectInitialInterval: 10 * time.Millisecond,
+		ReconnectMaxInterval:     10 * time.Millisecond,
+		StatusClient:             testNewFakeStatusClient(t),
+		MessageClient:            testNewFakeMessageClient(t),
+	}
+
+	client := NewClient(opts)
+	h.StartService(ctx, errGroup, client)
+	<-connecting
+
+	reloadedOpts := opts
+	reloadedOpts.BrokerAddresses = []string{newBroker}
+	client.Reconnect(reloadedOpts)
+	close(release)
+
+	// The connection made with the previous settings is disconnected and the client connects with the new ones
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		if previousClosed.Load() && client.State() == StateSubscribed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	require.True(t, previousClosed.Load())
+	require.Equal(t, StateSubscribed, client.State())
+	require.True(t, client.getMqttClient().IsConnected())
+	require.Equal(t, []string{newBroker}, client.Brokers())
+
+	cancel()
+
+	timeoutCtx, timeoutCancel := h.NewShutdownTimeoutContext()
+	defer timeoutCancel()
+
+	h.StopService(timeoutCtx, errGroup, client)
+
+	err := h.WaitForErrGroup(errGroup)
+	require.NoError(t, err)
+}
@@ -0,0 +1,61 @@
+package mqtt
+
+import (
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// RetainedPrint prints the retained messages like any other message
+	RetainedPrint = "print"
+	// RetainedSkip doesn't print the retained messages
+	RetainedSkip = "skip"
+	// RetainedFirstConnect prints the retained messages received when a subscription is first subscribed to,
+	// skipping the ones the broker re-delivers when subscribing again after a reconnect
+	RetainedFirstConnect = "first-connect"
+)
+
+// countSubscribe adds delta to the number of times the topic filter is subscribed to, it is incremented before
+// subscribing since the broker can deliver the retained messages before the subscribe call returns
+func (client *Client) countSubscribe(topic string, delta int) {
+	client.subscribeCountsMu.Lock()
+	defer client.subscribeCountsMu.Unlock()
+
+	client.subscribeCounts[topic] += delta
+	if client.subscribeCounts[topic] <= 0 {
+		delete(client.subscribeCounts, topic)
+	}
+}
+
+// resetSubscribeCount is used when the topic filter is removed, the retained messages are printed again if it's added back
+func (client *Client) resetSubscribeCount(topic string) {
+	client.subscribeCountsMu.Lock()
+	defer client.subscribeCountsMu.Unlock()
+
+	delete(client.subscribeCounts, topic)
+}
+
+// resubscribed returns true if the topic filter has been subscribed to more than once, like after a reconnect
+func (client *Client) resubscribed(topic string) bool {
+	client.subscribeCountsMu.Lock()
+	defer client.subscribeCountsMu.Unlock()
+
+	return client.subscribeCounts[topic] > 1
+}
+
+// skipRetained returns true if the message received for the subscription (topic filter) is retained and shouldn't be printed
+// according to the retained messages policy. MQTT v5 Retain Handling can't be used to stop the broker from sending them
+// since the client only supports MQTT v3.1.1.
+func (client *Client) skipRetained(subscription string, m pahomqtt.Message) bool {
+	if !m.Retained() {
+		return false
+	}
+
+	switch client.retainedMessages {
+	case RetainedSkip:
+		return true
+	case RetainedFirstConnect:
+		return client.resubscribed(subscription)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,65 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+)
+
+func TestRetainedFirstConnectPerSubscription(t *testing.T) {
+	errGroup, ctx, cancel := h.NewErrGroupAndContext()
+	defer cancel()
+
+	opts := Options{
+		BrokerAddresses:          []string{testNewFakeBroker(t, nil)},
+		Topic:                    "fake-topic",
+		QoS:                      1,
+		ClientID:                 "retained-first-connect-client",
+		ConnectTimeout:           time.Second,
+		ReconnectInitialInterval: 10 * time.Millisecond,
+		RetainedMessages:         RetainedFirstConnect,
+		StatusClient:             testNewFakeStatusClient(t),
+		MessageClient:            testNewFakeMessageClient(t),
+	}
+
+	client := NewClient(opts)
+	h.StartService(ctx, errGroup, client)
+	testWaitForState(t, client, StateSubscribed)
+
+	retained := &testFakeMqttMessage{topic: "fake-topic", payload: []byte("fake message"), retained: true}
+	require.False(t, client.skipRetained("fake-topic", retained))
+
+	// The topic is subscribed to again when reconnecting
+	client.Reconnect(opts)
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		if client.resubscribed("fake-topic") && client.State() == StateSubscribed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.True(t, client.skipRetained("fake-topic", retained))
+
+	// A subscription added after reconnecting gets its retained messages
+	err := client.AddSubscription("fake-topic-added/#", 1)
+	require.NoError(t, err)
+	require.False(t, client.skipRetained("fake-topic-added/#", retained))
+
+	// Also when it's added again after being removed
+	err = client.RemoveSubscription("fake-topic")
+	require.NoError(t, err)
+	err = client.AddSubscription("fake-topic", 1)
+	require.NoError(t, err)
+	require.False(t, client.skipRetained("fake-topic", retained))
+
+	cancel()
+
+	timeoutCtx, timeoutCancel := h.NewShutdownTimeoutContext()
+	defer timeoutCancel()
+
+	h.StopService(timeoutCtx, errGroup, client)
+
+	err = h.WaitForErrGroup(errGroup)
+	require.NoError(t, err)
+}
@@ -0,0 +1,104 @@
+package mqtt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+	"github.com/xenitab/mqtt-log-stdout/pkg/status"
+)
+
+// azureIoTHubAPIVersion is the api-version sent in the Azure IoT Hub username
+const azureIoTHubAPIVersion = "2021-04-12"
+
+// SASTokenOptions takes the input configuration for the Azure IoT Hub shared access signature provider
+type SASTokenOptions struct {
+	// HostName is the IoT Hub host name, like example.azure-devices.net
+	HostName string
+	DeviceID string
+	// SharedAccessKeyFile is read on every (re)connect when set, instead of using SharedAccessKey (base64 encoded)
+	SharedAccessKey     string
+	SharedAccessKeyFile string
+	// SharedAccessKeyName is the name of a shared access policy, empty for a device key
+	SharedAccessKeyName string
+	// TTL is how long the token is valid after connecting
+	TTL          time.Duration
+	StatusClient status.Client
+}
+
+// SASTokenCredentials is a CredentialsProvider using an Azure IoT Hub shared access signature (SAS) token as the password.
+// A new token is generated on every (re)connect, which makes it valid for the TTL after connecting.
+type SASTokenCredentials struct {
+	opts  SASTokenOptions
+	key   string
+	now   func() time.Time
+	mu    sync.Mutex
+	token string
+}
+
+// NewSASTokenCredentials returns an Azure IoT Hub SAS token provider
+func NewSASTokenCredentials(opts SASTokenOptions) *SASTokenCredentials {
+	return &SASTokenCredentials{
+		opts: opts,
+		key:  opts.SharedAccessKey,
+		now:  time.Now,
+	}
+}
+
+// Username returns the username required by Azure IoT Hub
+func (c *SASTokenCredentials) Username() string {
+	return fmt.Sprintf("%s/%s/?api-version=%s", c.opts.HostName, c.opts.DeviceID, azureIoTHubAPIVersion)
+}
+
+// Credentials returns the username and a new SAS token, the previous token is used if the key can't be read or is invalid
+func (c *SASTokenCredentials) Credentials() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.opts.SharedAccessKeyFile != "" {
+		key, err := h.ReadSecretFile(c.opts.SharedAccessKeyFile)
+		if err != nil {
+			c.opts.StatusClient.Warn("Unable to read Azure IoT Hub shared access key file, using the previous key", "file", c.opts.SharedAccessKeyFile, "error", err)
+		} else {
+			c.key = key
+		}
+	}
+
+	token, err := c.generateToken(c.now().Add(c.opts.TTL))
+	if err != nil {
+		c.opts.StatusClient.Warn("Unable to generate Azure IoT Hub SAS token, using the previous token", "error", err)
+		return c.Username(), c.token
+	}
+
+	c.token = token
+
+	return c.Username(), c.token
+}
+
+// generateToken returns a SAS token for the device, see https://learn.microsoft.com/azure/iot-hub/authenticate-authorize-sas
+func (c *SASTokenCredentials) generateToken(expiry time.Time) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(c.key)
+	if err != nil {
+		return "", fmt.Errorf("shared access key isn't base64 encoded: %w", err)
+	}
+
+	resourceURI := url.QueryEscape(fmt.Sprintf("%s/devices/%s", c.opts.HostName, c.opts.DeviceID))
+	expiryUnix := strconv.FormatInt(expiry.Unix(), 10)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(resourceURI + "\n" + expiryUnix))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	token := fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s", resourceURI, url.QueryEscape(signature), expiryUnix)
+	if c.opts.SharedAccessKeyName != "" {
+		token += fmt.Sprintf("&skn=%s", url.QueryEscape(c.opts.SharedAccessKeyName))
+	}
+
+	return token, nil
+}
@@ -0,0 +1,54 @@
+package mqtt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSASTokenCredentials(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "shared-access-key")
+	err := os.WriteFile(keyFile, []byte("dGVzdC1rZXk=\n"), 0600)
+	require.NoError(t, err)
+
+	credentials := NewSASTokenCredentials(SASTokenOptions{
+		HostName:            "example.azure-devices.net",
+		DeviceID:            "device-1",
+		SharedAccessKeyFile: keyFile,
+		TTL:                 time.Hour,
+		StatusClient:        testNewFakeStatusClient(t),
+	})
+	credentials.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	username, password := credentials.Credentials()
+	require.Equal(t, "example.azure-devices.net/device-1/?api-version=2021-04-12", username)
+	require.Equal(t, "SharedAccessSignature sr=example.azure-devices.net%2Fdevices%2Fdevice-1&sig=7kvxWprhHgJmzPupC8iwBgp2F%2BRgXOcftarJ0Th3K%2Fo%3D&se=1700003600", password)
+
+	// A new token is generated on every (re)connect
+	credentials.now = func() time.Time { return time.Unix(1700000060, 0) }
+	_, newPassword := credentials.Credentials()
+	require.NotEqual(t, password, newPassword)
+	require.Contains(t, newPassword, "&se=1700003660")
+
+	// The previous token is used if the key isn't valid
+	err = os.WriteFile(keyFile, []byte("not base64"), 0600)
+	require.NoError(t, err)
+	_, password = credentials.Credentials()
+	require.Equal(t, newPassword, password)
+
+	// A shared access policy name is added to the token
+	credentials = NewSASTokenCredentials(SASTokenOptions{
+		HostName:            "example.azure-devices.net",
+		DeviceID:            "device-1",
+		SharedAccessKey:     "dGVzdC1rZXk=",
+		SharedAccessKeyName: "device",
+		TTL:                 time.Hour,
+		StatusClient:        testNewFakeStatusClient(t),
+	})
+
+	_, password = credentials.Credentials()
+	require.Contains(t, password, "&skn=device")
+}
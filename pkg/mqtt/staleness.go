@@ -0,0 +1,148 @@
+package mqtt
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stalenessTracker keeps track of when the last message was received, per subscription (topic filter) to not hide
+// a silent subscription behind an active one
+type stalenessTracker struct {
+	threshold time.Duration
+	// lastReceived is when the last message was received for any subscription
+	lastReceived  atomic.Int64
+	subscriptions map[string]*subscriptionStaleness
+	mu            sync.Mutex
+}
+
+type subscriptionStaleness struct {
+	lastReceived time.Time
+	stale        bool
+}
+
+// stalenessChange is a subscription that became stale or received messages again, or started being tracked
+type stalenessChange struct {
+	subscription string
+	started      bool
+	stale        bool
+	silentFor    time.Duration
+}
+
+func newStalenessTracker(threshold time.Duration) *stalenessTracker {
+	tracker := &stalenessTracker{
+		threshold:     threshold,
+		subscriptions: make(map[string]*subscriptionStaleness),
+	}
+
+	tracker.lastReceived.Store(time.Now().UnixNano())
+
+	return tracker
+}
+
+func (tracker *stalenessTracker) received(subscription string, t time.Time) {
+	tracker.lastReceived.Store(t.UnixNano())
+
+	if tracker.threshold == 0 {
+		return
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	state, found := tracker.subscriptions[subscription]
+	if !found {
+		state = &subscriptionStaleness{}
+		tracker.subscriptions[subscription] = state
+	}
+
+	state.lastReceived = t
+}
+
+// remove stops tracking the subscription, used when it is removed
+func (tracker *stalenessTracker) remove(subscription string) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	delete(tracker.subscriptions, subscription)
+}
+
+// check returns the subscriptions that became stale or received messages again since the previous check.
+// Subscriptions that aren't tracked yet (like new ones) are returned as not stale and are silent from now.
+func (tracker *stalenessTracker) check(subscriptions []string, now time.Time) []stalenessChange {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	// Subscriptions that were removed (and received a message after being removed) aren't tracked anymore
+	current := make(map[string]bool, len(subscriptions))
+	for _, subscription := range subscriptions {
+		current[subscription] = true
+	}
+	for subscription := range tracker.subscriptions {
+		if !current[subscription] {
+			delete(tracker.subscriptions, subscription)
+		}
+	}
+
+	changes := []stalenessChange{}
+	for _, subscription := range subscriptions {
+		state, found := tracker.subscriptions[subscription]
+		if !found {
+			tracker.subscriptions[subscription] = &subscriptionStaleness{lastReceived: now}
+			changes = append(changes, stalenessChange{subscription: subscription, started: true})
+			continue
+		}
+
+		silentFor := now.Sub(state.lastReceived)
+		stale := silentFor > tracker.threshold
+		if stale != state.stale {
+			state.stale = stale
+			changes = append(changes, stalenessChange{subscription: subscription, stale: stale, silentFor: silentFor})
+		}
+	}
+
+	return changes
+}
+
+// watchStaleness prints a status warning when no messages have been received for a subscription within the staleness threshold
+func (client *Client) watchStaleness(ctx context.Context) {
+	interval := client.staleness.threshold / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			client.checkStaleness(now)
+		}
+	}
+}
+
+func (client *Client) checkStaleness(now time.Time) {
+	subscriptions := []string{}
+	for subscription := range client.Subscriptions() {
+		subscriptions = append(subscriptions, subscription)
+	}
+	sort.Strings(subscriptions)
+
+	for _, change := range client.staleness.check(subscriptions, now) {
+		switch {
+		case change.started:
+			client.metrics.stale.WithLabelValues(change.subscription).Set(0)
+		case change.stale:
+			client.metrics.stale.WithLabelValues(change.subscription).Set(1)
+			client.statusClient.Warn("Subscription is silent", "topic", change.subscription, "silent_for", change.silentFor.Round(time.Second).String())
+		default:
+			client.metrics.stale.WithLabelValues(change.subscription).Set(0)
+			client.statusClient.Info("Messages received again", "topic", change.subscription)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package mqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchStaleness(t *testing.T) {
+	client := &Client{
+		statusClient:  testNewFakeStatusClient(t),
+		metrics:       newClientMetrics(nil, false),
+		staleness:     newStalenessTracker(100 * time.Millisecond),
+		subscriptions: map[string]int{"fake-topic": 0},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.watchStaleness(ctx)
+	}()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		if testutil.ToFloat64(client.metrics.stale.WithLabelValues("fake-topic")) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	require.Equal(t, float64(1), testutil.ToFloat64(client.metrics.stale.WithLabelValues("fake-topic")))
+
+	client.staleness.received("fake-topic", time.Now())
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		if testutil.ToFloat64(client.metrics.stale.WithLabelValues("fake-topic")) == 0 {
+			break
+		}
+		client.staleness.received("fake-topic", time.Now())
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	require.Equal(t, float64(0), testutil.ToFloat64(client.metrics.stale.WithLabelValues("fake-topic")))
+
+	cancel()
+	<-done
+}
+
+func TestCheckStaleness(t *testing.T) {
+	clientMetrics := newClientMetrics(nil, false)
+	client := &Client{
+		statusClient:  testNewFakeStatusClient(t),
+		metrics:       clientMetrics,
+		state:         newConnectionStateTracker(clientMetrics.connectionState),
+		staleness:     newStalenessTracker(time.Minute),
+		subscriptions: map[string]int{"fake-topic": 0, "fake-topic-2/#": 0},
+	}
+
+	start := time.Now()
+
+	// New subscriptions are silent from the first check
+	client.checkStaleness(start)
+	require.Equal(t, 2, testutil.CollectAndCount(client.metrics.stale))
+	require.Equal(t, float64(0), testutil.ToFloat64(client.metrics.stale.WithLabelValues("fake-topic")))
+
+	// A silent subscription isn't hidden by an active one
+	client.staleness.received("fake-topic-2/#", start.Add(50*time.Second))
+	client.checkStaleness(start.Add(90 * time.Second))
+	require.Equal(t, float64(1), testutil.ToFloat64(client.metrics.stale.WithLabelValues("fake-topic")))
+	require.Equal(t, float64(0), testutil.ToFloat64(client.metrics.stale.WithLabelValues("fake-topic-2/#")))
+	require.Contains(t, testLogged(client.statusClient), "WARN Subscription is silent [topic fake-topic silent_for 1m30s]")
+
+	client.staleness.received("fake-topic", start.Add(100*time.Second))
+	client.checkStaleness(start.Add(120 * time.Second))
+	require.Equal(t, float64(0), testutil.ToFloat64(client.metrics.stale.WithLabelValues("fake-topic")))
+	require.Equal(t, float64(1), testutil.ToFloat64(client.metrics.stale.WithLabelValues("fake-topic-2/#")))
+	require.Contains(t, testLogged(client.statusClient), "INFO Messages received again [topic fake-topic]")
+	require.Contains(t, testLogged(client.statusClient), "WARN Subscription is silent [topic fake-topic-2/# silent_for 1m10s]")
+
+	// Removed subscriptions aren't reported anymore
+	err := client.RemoveSubscription("fake-topic-2/#")
+	require.NoError(t, err)
+	require.Equal(t, 1, testutil.CollectAndCount(client.metrics.stale))
+}
@@ -0,0 +1,127 @@
+package mqtt
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ConnectionState is the state of the connection between the MQTT client and the broker
+type ConnectionState int
+
+const (
+	// StateConnecting is used while a connection attempt is made, the initial one or when reconnecting
+	StateConnecting ConnectionState = iota
+	// StateConnected is used when connected to the broker, but before subscribing
+	StateConnected
+	// StateSubscribing is used while waiting for the broker to grant the subscription
+	StateSubscribing
+	// StateSubscribed is used when the subscription is granted and messages are received
+	StateSubscribed
+	// StateReconnecting is used after the connection is lost, while waiting for the next reconnect attempt
+	StateReconnecting
+	// StateStopped is used when the client is stopped, no other state can follow it
+	StateStopped
+)
+
+var connectionStateNames = map[ConnectionState]string{
+	StateConnecting:   "connecting",
+	StateConnected:    "connected",
+	StateSubscribing:  "subscribing",
+	StateSubscribed:   "subscribed",
+	StateReconnecting: "reconnecting",
+	StateStopped:      "stopped",
+}
+
+// String returns the name of the connection state
+func (state ConnectionState) String() string {
+	name, ok := connectionStateNames[state]
+	if !ok {
+		return "unknown"
+	}
+
+	return name
+}
+
+// connectionStateTracker keeps track of the connection state and notifies subscribers about changes
+type connectionStateTracker struct {
+	mu          sync.RWMutex
+	state       ConnectionState
+	subscribers map[chan ConnectionState]struct{}
+	// metric is the enum gauge (label "state") reflecting the current state
+	metric *prometheus.GaugeVec
+}
+
+func newConnectionStateTracker(metric *prometheus.GaugeVec) *connectionStateTracker {
+	tracker := &connectionStateTracker{
+		state:       StateConnecting,
+		subscribers: make(map[chan ConnectionState]struct{}),
+		metric:      metric,
+	}
+
+	tracker.setMetrics(tracker.state)
+
+	return tracker
+}
+
+func (tracker *connectionStateTracker) get() ConnectionState {
+	tracker.mu.RLock()
+	defer tracker.mu.RUnlock()
+	return tracker.state
+}
+
+// set changes the state and returns false if the change isn't allowed (the client is stopped)
+func (tracker *connectionStateTracker) set(state ConnectionState) bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if tracker.state == StateStopped {
+		return false
+	}
+
+	tracker.state = state
+	tracker.setMetrics(state)
+
+	for ch := range tracker.subscribers {
+		// Subscribers only keep the latest state, a pending state is replaced if the subscriber hasn't received it yet
+		select {
+		case ch <- state:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- state
+		}
+	}
+
+	return true
+}
+
+// subscribe returns a channel receiving state changes and a function to stop receiving them
+func (tracker *connectionStateTracker) subscribe() (<-chan ConnectionState, func()) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	ch := make(chan ConnectionState, 1)
+	tracker.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		tracker.mu.Lock()
+		defer tracker.mu.Unlock()
+		delete(tracker.subscribers, ch)
+	}
+
+	return ch, unsubscribe
+}
+
+func (tracker *connectionStateTracker) setMetrics(current ConnectionState) {
+	for state, name := range connectionStateNames {
+		value := 0.0
+		if state == current {
+			value = 1
+		}
+
+		tracker.metric.WithLabelValues(name).Set(value)
+	}
+}
@@ -0,0 +1,141 @@
+package mqtt
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+)
+
+func TestConnectionStateString(t *testing.T) {
+	require.Equal(t, "connecting", StateConnecting.String())
+	require.Equal(t, "subscribed", StateSubscribed.String())
+	require.Equal(t, "stopped", StateStopped.String())
+	require.Equal(t, "unknown", ConnectionState(100).String())
+}
+
+func TestConnectionStateTracker(t *testing.T) {
+	tracker := newConnectionStateTracker(newClientMetrics(nil, false).connectionState)
+	require.Equal(t, StateConnecting, tracker.get())
+	require.Equal(t, float64(1), testutil.ToFloat64(tracker.metric.WithLabelValues("connecting")))
+
+	stateCh, unsubscribe := tracker.subscribe()
+	defer unsubscribe()
+
+	require.True(t, tracker.set(StateConnected))
+	require.Equal(t, StateConnected, <-stateCh)
+
+	// Only the latest state is kept for a receiver that hasn't received the previous one
+	require.True(t, tracker.set(StateSubscribing))
+	require.True(t, tracker.set(StateSubscribed))
+	require.Equal(t, StateSubscribed, <-stateCh)
+	require.Equal(t, float64(1), testutil.ToFloat64(tracker.metric.WithLabelValues("subscribed")))
+	require.Equal(t, float64(0), testutil.ToFloat64(tracker.metric.WithLabelValues("connecting")))
+
+	// No state can follow stopped
+	require.True(t, tracker.set(StateStopped))
+	require.False(t, tracker.set(StateConnected))
+	require.Equal(t, StateStopped, tracker.get())
+	require.Equal(t, StateStopped, <-stateCh)
+}
+
+func TestConnectionStateReconnect(t *testing.T) {
+	errGroup, ctx, cancel := h.NewErrGroupAndContext()
+	defer cancel()
+
+	// The first connection is closed by the test and the reconnect is only acknowledged when released
+	firstConn := make(chan net.Conn, 1)
+	reconnecting := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var connections atomic.Int64
+	broker := testStartFakeBroker(t, func(conn net.Conn) {
+		if connections.Add(1) == 1 {
+			firstConn <- conn
+		} else {
+			reconnecting <- struct{}{}
+			<-release
+		}
+
+		testServeFakeBroker(conn, nil)
+	})
+
+	opts := Options{
+		BrokerAddresses:          []string{broker},
+		Topic:                    "fake-topic",
+		QoS:                      1,
+		ClientID:                 "connection-state-client",
+		ConnectTimeout:           5 * time.Second,
+		ReconnectInitialInterval: 200 * time.Millisecond,
+		ReconnectMaxInterval:     200 * time.Millisecond,
+		StatusClient:             testNewFakeStatusClient(t),
+		MessageClient:            testNewFakeMessageClient(t),
+	}
+
+	client := NewClient(opts)
+	require.Equal(t, StateConnecting, client.State())
+
+	h.StartService(ctx, errGroup, client)
+	testWaitForState(t, client, StateSubscribed)
+
+	// The client waits for the reconnect attempt after the connection is lost
+	conn := <-firstConn
+	conn.Close()
+	testWaitForState(t, client, StateReconnecting)
+	require.Equal(t, float64(1), testutil.ToFloat64(client.metrics.connectionState.WithLabelValues("reconnecting")))
+
+	// The state is connecting during the reconnect attempt
+	<-reconnecting
+	testWaitForState(t, client, StateConnecting)
+	require.Equal(t, float64(1), testutil.ToFloat64(client.metrics.connectionState.WithLabelValues("connecting")))
+	require.Equal(t, float64(0), testutil.ToFloat64(client.metrics.connectionState.WithLabelValues("reconnecting")))
+
+	close(release)
+	testWaitForState(t, client, StateSubscribed)
+	require.Equal(t, float64(0), testutil.ToFloat64(client.metrics.connectionState.WithLabelValues("connecting")))
+
+	cancel()
+
+	timeoutCtx, timeoutCancel := h.NewShutdownTimeoutContext()
+	defer timeoutCancel()
+
+	h.StopService(timeoutCtx, errGroup, client)
+
+	err := h.WaitForErrGroup(errGroup)
+	require.NoError(t, err)
+	require.Equal(t, StateStopped, client.State())
+}
+
+func TestConnectionStateTrackerConcurrency(t *testing.T) {
+	tracker := newConnectionStateTracker(newClientMetrics(nil, false).connectionState)
+
+	numberOfWorkers := 10
+	changesPerWorker := 200
+	errGroup, _, _ := h.NewErrGroupAndContext()
+
+	for w := 0; w < numberOfWorkers; w++ {
+		errGroup.Go(func() error {
+			stateCh, unsubscribe := tracker.subscribe()
+			defer unsubscribe()
+
+			for i := 0; i < changesPerWorker; i++ {
+				tracker.set(ConnectionState(i % int(StateStopped)))
+				_ = tracker.get()
+
+				select {
+				case <-stateCh:
+				default:
+				}
+			}
+
+			return nil
+		})
+	}
+
+	err := h.WaitForErrGroup(errGroup)
+	require.NoError(t, err)
+	require.NotEqual(t, StateStopped, tracker.get())
+}
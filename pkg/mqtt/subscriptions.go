@@ -0,0 +1,173 @@
+package mqtt
+
+import (
+	"fmt"
+	"sort"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+)
+
+// Subscriptions returns the topic filters and their requested QoS, kept across reconnects
+func (client *Client) Subscriptions() map[string]int {
+	client.subscriptionsMu.Lock()
+	defer client.subscriptionsMu.Unlock()
+
+	subscriptions := make(map[string]int, len(client.subscriptions))
+	for topic, qos := range client.subscriptions {
+		subscriptions[topic] = qos
+	}
+
+	return subscriptions
+}
+
+// AddSubscription subscribes to the topic filter, or changes the QoS if it is already subscribed to.
+// The subscription is made directly when connected and is re-applied after every reconnect.
+func (client *Client) AddSubscription(topic string, qos int) error {
+	err := ValidateTopicFilter(topic)
+	if err != nil {
+		return fmt.Errorf("%w: %s", h.ErrInvalidSubscription, err)
+	}
+
+	if qos < 0 || qos > 2 {
+		return fmt.Errorf("%w: QoS allowed to be 0, 1 or 2, received: %d", h.ErrInvalidSubscription, qos)
+	}
+
+	client.subscriptionsMu.Lock()
+	defer client.subscriptionsMu.Unlock()
+
+	if client.Connected() {
+		err := client.subscribe(client.getMqttClient(), topic, qos)
+		if err != nil {
+			return err
+		}
+	}
+
+	client.subscriptions[topic] = qos
+	client.statusClient.Info("Subscription added", "topic", topic, "qos", qos)
+
+	return nil
+}
+
+// RemoveSubscription unsubscribes from the topic filter, it is unsubscribed from directly when connected
+func (client *Client) RemoveSubscription(topic string) error {
+	client.subscriptionsMu.Lock()
+	defer client.subscriptionsMu.Unlock()
+
+	_, found := client.subscriptions[topic]
+	if !found {
+		return fmt.Errorf("%w: %s", h.ErrSubscriptionNotFound, topic)
+	}
+
+	if client.Connected() {
+		unsubToken := client.getMqttClient().Unsubscribe(topic)
+		<-unsubToken.Done()
+		if unsubToken.Error() != nil {
+			client.statusClient.Warn("Unable to unsubscribe from topic", "topic", topic, "error", unsubToken.Error())
+			return unsubToken.Error()
+		}
+	}
+
+	delete(client.subscriptions, topic)
+	client.resetSubscribeCount(topic)
+	client.metrics.subscriptionGrantedQoS.DeleteLabelValues(topic)
+	client.metrics.lastMessageReceived.DeleteLabelValues(topic)
+	client.metrics.stale.DeleteLabelValues(topic)
+	client.staleness.remove(topic)
+	client.statusClient.Info("Subscription removed", "topic", topic)
+
+	return nil
+}
+
+// Pause stops printing messages, received messages are acknowledged and dropped until Resume() is called
+func (client *Client) Pause() {
+	if client.paused.CompareAndSwap(false, true) {
+		client.statusClient.Info("Printing messages paused")
+	}
+}
+
+// Resume starts printing messages again after Pause()
+func (client *Client) Resume() {
+	if client.paused.CompareAndSwap(true, false) {
+		client.statusClient.Info("Printing messages resumed")
+	}
+}
+
+// Paused returns true if printing messages is paused
+func (client *Client) Paused() bool {
+	return client.paused.Load()
+}
+
+// subscribeAll subscribes to all topic filters, used after (re)connecting
+func (client *Client) subscribeAll(c pahomqtt.Client) error {
+	client.subscriptionsMu.Lock()
+	defer client.subscriptionsMu.Unlock()
+
+	topics := make([]string, 0, len(client.subscriptions))
+	for topic := range client.subscriptions {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	for _, topic := range topics {
+		err := client.subscribe(c, topic, client.subscriptions[topic])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unsubscribeAll unsubscribes from all topic filters, used when stopping
+func (client *Client) unsubscribeAll() {
+	topics := []string{}
+	for topic := range client.Subscriptions() {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	if len(topics) == 0 {
+		return
+	}
+
+	unsubToken := client.getMqttClient().Unsubscribe(topics...)
+	<-unsubToken.Done()
+
+	if unsubToken.Error() != nil {
+		client.statusClient.Warn("Unable to gracefully unsubscribe", "topics", topics, "error", unsubToken.Error())
+		return
+	}
+
+	client.statusClient.Info("Unsubscribed", "topics", topics)
+}
+
+func (client *Client) subscribe(c pahomqtt.Client, topic string, qos int) error {
+	client.countSubscribe(topic, 1)
+	subToken := c.Subscribe(topic, byte(qos), client.messageHandler(topic))
+
+	<-subToken.Done()
+	if subToken.Error() != nil {
+		client.countSubscribe(topic, -1)
+		client.statusClient.Error("Unable to subscribe to topic", "topic", topic, "error", subToken.Error())
+		return subToken.Error()
+	}
+
+	grantedQoS, allowed := subscriptionAllowed(subToken, topic)
+	if !allowed {
+		client.countSubscribe(topic, -1)
+		err := fmt.Errorf("subscription not allowed")
+		client.statusClient.Error("Subscription not allowed", "topic", topic, "error", err)
+		return err
+	}
+
+	client.metrics.subscriptionGrantedQoS.WithLabelValues(topic).Set(float64(grantedQoS))
+	if int(grantedQoS) < qos {
+		client.metrics.totalSubscriptionDowngrades.Inc()
+		client.statusClient.Warn("Subscription downgraded by the broker", "topic", topic, "requested_qos", qos, "granted_qos", grantedQoS)
+	}
+
+	client.statusClient.Info("Subscription started", "topic", topic, "qos", grantedQoS)
+
+	return nil
+}
@@ -0,0 +1,255 @@
+package mqtt
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	h "github.com/xenitab/mqtt-log-stdout/pkg/helper"
+)
+
+func TestSubscriptionsNotConnected(t *testing.T) {
+	opts := Options{
+		BrokerAddresses: []string{"tcp://127.0.0.1:1883"},
+		Topic:           "fake-topic",
+		QoS:             1,
+		ClientID:        "subscriptions-client",
+		StatusClient:    testNewFakeStatusClient(t),
+		MessageClient:   testNewFakeMessageClient(t),
+	}
+
+	client := NewClient(opts)
+	require.Equal(t, map[string]int{"fake-topic": 1}, client.Subscriptions())
+
+	// Subscriptions are stored and subscribed to when connected
+	err := client.AddSubscription("fake-topic-2/+", 2)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"fake-topic": 1, "fake-topic-2/+": 2}, client.Subscriptions())
+
+	err = client.AddSubscription("fake-topic-3", 3)
+	require.ErrorIs(t, err, h.ErrInvalidSubscription)
+	require.ErrorContains(t, err, "QoS allowed to be 0, 1 or 2, received: 3")
+
+	err = client.AddSubscription("fake-topic-3/#/fake", 0)
+	require.ErrorContains(t, err, "can only use '#' as the last level")
+
+	err = client.RemoveSubscription("fake-topic")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"fake-topic-2/+": 2}, client.Subscriptions())
+
+	err = client.RemoveSubscription("fake-topic")
+	require.ErrorIs(t, err, h.ErrSubscriptionNotFound)
+
+	// SetTopic replaces the topic from the options, also when it has been removed
+	err = client.SetTopic("fake-topic-4", 1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"fake-topic-2/+": 2, "fake-topic-4": 1}, client.Subscriptions())
+
+	err = client.SetTopic("fake-topic-5", 0)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"fake-topic-2/+": 2, "fake-topic-5": 0}, client.Subscriptions())
+
+	err = client.SetTopic("fake-topic-5/#/fake", 0)
+	require.ErrorIs(t, err, h.ErrInvalidSubscription)
+	require.Equal(t, "fake-topic-5", client.getTopic())
+
+	require.False(t, client.Paused())
+	client.Pause()
+	require.True(t, client.Paused())
+	client.Resume()
+	require.False(t, client.Paused())
+}
+
+func TestSubscriptionMetrics(t *testing.T) {
+	errGroup, ctx, cancel := h.NewErrGroupAndContext()
+	defer cancel()
+
+	opts := Options{
+		BrokerAddresses: []string{testNewFakeBroker(t, nil)},
+		Topic:           "fake-topic",
+		QoS:             1,
+		ClientID:        "subscription-metrics-client",
+		ConnectTimeout:  time.Second,
+		StatusClient:    testNewFakeStatusClient(t),
+		MessageClient:   testNewFakeMessageClient(t),
+	}
+
+	client := NewClient(opts)
+	h.StartService(ctx, errGroup, client)
+	testWaitForState(t, client, StateSubscribed)
+
+	err := client.AddSubscription("fake-topic-2/+", 2)
+	require.NoError(t, err)
+
+	// The granted QoS is reported per subscription
+	require.Equal(t, float64(1), testutil.ToFloat64(client.metrics.subscriptionGrantedQoS.WithLabelValues("fake-topic")))
+	require.Equal(t, float64(2), testutil.ToFloat64(client.metrics.subscriptionGrantedQoS.WithLabelValues("fake-topic-2/+")))
+
+	err = client.RemoveSubscription("fake-topic-2/+")
+	require.NoError(t, err)
+	require.Equal(t, 1, testutil.CollectAndCount(client.metrics.subscriptionGrantedQoS))
+
+	cancel()
+
+	timeoutCtx, timeoutCancel := h.NewShutdownTimeoutContext()
+	defer timeoutCancel()
+
+	h.StopService(timeoutCtx, errGroup, client)
+
+	err = h.WaitForErrGroup(errGroup)
+	require.NoError(t, err)
+}
+
+func TestSubscriptionDowngrade(t *testing.T) {
+	errGroup, ctx, cancel := h.NewErrGroupAndContext()
+	defer cancel()
+
+	// The broker grants QoS 0 for all subscriptions
+	grantQoS := func(topic string, qos byte) byte {
+		return 0
+	}
+
+	opts := Options{
+		BrokerAddresses: []string{testNewFakeBroker(t, grantQoS)},
+		Topic:           "fake-topic",
+		QoS:             2,
+		ClientID:        "subscription-downgrade-client",
+		ConnectTimeout:  time.Second,
+		StatusClient:    testNewFakeStatusClient(t),
+		MessageClient:   testNewFakeMessageClient(t),
+	}
+
+	client := NewClient(opts)
+	h.StartService(ctx, errGroup, client)
+	testWaitForState(t, client, StateSubscribed)
+
+	require.Contains(t, testLogged(opts.StatusClient), "WARN Subscription downgraded by the broker [topic fake-topic requested_qos 2 granted_qos 0]")
+	require.Equal(t, float64(0), testutil.ToFloat64(client.metrics.subscriptionGrantedQoS.WithLabelValues("fake-topic")))
+	require.Equal(t, float64(1), testutil.ToFloat64(client.metrics.totalSubscriptionDowngrades))
+
+	cancel()
+
+	timeoutCtx, timeoutCancel := h.NewShutdownTimeoutContext()
+	defer timeoutCancel()
+
+	h.StopService(timeoutCtx, errGroup, client)
+
+	err := h.WaitForErrGroup(errGroup)
+	require.NoError(t, err)
+}
+
+func testWaitForState(t *testing.T, client *Client, expected ConnectionState) {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		if client.State() == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	require.Equal(t, expected, client.State())
+}
+
+// testNewFakeBroker starts an MQTT broker that only acknowledges the packets, subscriptions are granted with the QoS
+// returned by grantQoS (the requested QoS if nil). It returns the broker address and is stopped when the test ends.
+func testNewFakeBroker(t *testing.T, grantQoS func(topic string, qos byte) byte) string {
+	t.Helper()
+
+	return testStartFakeBroker(t, func(conn net.Conn) {
+		testServeFakeBroker(conn, grantQoS)
+	})
+}
+
+// testStartFakeBroker starts a listener calling serve for every connection, it returns the broker address and
+// the listener and connections are closed when the test ends
+func testStartFakeBroker(t *testing.T, serve func(conn net.Conn)) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var connsMu sync.Mutex
+	conns := []net.Conn{}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			connsMu.Lock()
+			conns = append(conns, conn)
+			connsMu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				serve(conn)
+			}()
+		}
+	}()
+
+	t.Cleanup(func() {
+		listener.Close()
+		connsMu.Lock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		connsMu.Unlock()
+		wg.Wait()
+	})
+
+	return "tcp://" + listener.Addr().String()
+}
+
+func testServeFakeBroker(conn net.Conn, grantQoS func(topic string, qos byte) byte) {
+	defer conn.Close()
+
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		var response packets.ControlPacket
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			response = packets.NewControlPacket(packets.Connack)
+		case *packets.SubscribePacket:
+			suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			suback.MessageID = p.MessageID
+			for i, topic := range p.Topics {
+				granted := p.Qoss[i]
+				if grantQoS != nil {
+					granted = grantQoS(topic, p.Qoss[i])
+				}
+				suback.ReturnCodes = append(suback.ReturnCodes, granted)
+			}
+			response = suback
+		case *packets.UnsubscribePacket:
+			unsuback := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+			unsuback.MessageID = p.MessageID
+			response = unsuback
+		case *packets.PingreqPacket:
+			response = packets.NewControlPacket(packets.Pingresp)
+		case *packets.DisconnectPacket:
+			return
+		default:
+			continue
+		}
+
+		err = response.Write(conn)
+		if err != nil {
+			return
+		}
+	}
+}
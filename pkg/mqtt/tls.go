@@ -0,0 +1,61 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// tlsEnabled returns true if any of the TLS options are set, the paho defaults are used otherwise
+func (opts Options) tlsEnabled() bool {
+	return opts.TLSCAFile != "" || opts.TLSCertFile != "" || opts.TLSKeyFile != "" || len(opts.TLSALPNProtocols) > 0 || opts.TLSInsecureSkipVerify
+}
+
+// newTLSConfig returns the tls config used for the ssl, tls, mqtts, tcps and wss brokers.
+// The client certificate is read on every (re)connect, to use renewed certificates without a restart.
+func newTLSConfig(opts Options) *tls.Config {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		NextProtos:         opts.TLSALPNProtocols,
+		InsecureSkipVerify: opts.TLSInsecureSkipVerify, // #nosec G402
+	}
+
+	if opts.TLSCAFile != "" {
+		rootCAs, err := loadCertPool(opts.TLSCAFile)
+		if err != nil {
+			// An empty pool makes the connection fail instead of falling back to the system CAs
+			opts.StatusClient.Error("Unable to load mqtt TLS CA file", "file", opts.TLSCAFile, "error", err)
+			rootCAs = x509.NewCertPool()
+		}
+
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if opts.TLSCertFile != "" {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(opts.TLSCertFile, opts.TLSKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to load mqtt TLS certificate %q and key %q: %w", opts.TLSCertFile, opts.TLSKeyFile, err)
+			}
+
+			return &cert, nil
+		}
+	}
+
+	return tlsConfig
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	caPEM, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %q", file)
+	}
+
+	return pool, nil
+}
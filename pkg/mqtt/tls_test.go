@@ -0,0 +1,42 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	require.False(t, Options{}.tlsEnabled())
+	require.True(t, Options{TLSALPNProtocols: []string{"x-amzn-mqtt-ca"}}.tlsEnabled())
+
+	tlsConfig := newTLSConfig(Options{
+		TLSALPNProtocols: []string{"x-amzn-mqtt-ca"},
+		StatusClient:     testNewFakeStatusClient(t),
+	})
+	require.Equal(t, []string{"x-amzn-mqtt-ca"}, tlsConfig.NextProtos)
+	require.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	require.Nil(t, tlsConfig.RootCAs)
+	require.Nil(t, tlsConfig.GetClientCertificate)
+
+	// An invalid CA file makes the connection fail instead of using the system CAs
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	err := os.WriteFile(caFile, []byte("not a certificate"), 0600)
+	require.NoError(t, err)
+
+	tlsConfig = newTLSConfig(Options{
+		TLSCAFile:    caFile,
+		TLSCertFile:  filepath.Join(t.TempDir(), "missing.crt"),
+		TLSKeyFile:   filepath.Join(t.TempDir(), "missing.key"),
+		StatusClient: testNewFakeStatusClient(t),
+	})
+	require.NotNil(t, tlsConfig.RootCAs)
+	require.True(t, tlsConfig.RootCAs.Equal(x509.NewCertPool()))
+
+	_, err = tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{})
+	require.ErrorContains(t, err, "unable to load mqtt TLS certificate")
+}
@@ -0,0 +1,105 @@
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// topicLabelOther is the label used for all topics when the max number of topic labels is reached,
+// the underscores keep it apart from a topic named "other"
+const topicLabelOther = "__other__"
+
+// defaultTopicMaxLabels is used when the max number of topic labels isn't set
+const defaultTopicMaxLabels = 100
+
+// topicLabeler converts topics to metric labels while keeping the label cardinality bounded
+type topicLabeler struct {
+	// depth is the number of topic levels used for the label (0 = the full topic)
+	depth int
+	// maxLabels is the max number of distinct labels, the rest is folded into topicLabelOther
+	maxLabels int
+	labels    map[string]struct{}
+	mu        sync.Mutex
+}
+
+func newTopicLabeler(depth int, maxLabels int) *topicLabeler {
+	if maxLabels <= 0 {
+		maxLabels = defaultTopicMaxLabels
+	}
+
+	return &topicLabeler{
+		depth:     depth,
+		maxLabels: maxLabels,
+		labels:    make(map[string]struct{}),
+	}
+}
+
+// label returns the metric label for the topic
+func (labeler *topicLabeler) label(topic string) string {
+	label := topic
+	if labeler.depth > 0 {
+		levels := strings.SplitN(topic, "/", labeler.depth+1)
+		if len(levels) > labeler.depth {
+			label = strings.Join(levels[:labeler.depth], "/")
+		}
+	}
+
+	labeler.mu.Lock()
+	defer labeler.mu.Unlock()
+
+	_, found := labeler.labels[label]
+	if found {
+		return label
+	}
+
+	if len(labeler.labels) >= labeler.maxLabels {
+		return topicLabelOther
+	}
+
+	labeler.labels[label] = struct{}{}
+
+	return label
+}
+
+// ValidateTopicFilter makes sure the wildcards are used correctly, '#' needs to be the last level and '+' a full level
+func ValidateTopicFilter(topic string) error {
+	if topic == "" {
+		return fmt.Errorf("topic filter can't be empty")
+	}
+
+	levels := strings.Split(topic, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("topic filter %q can only use '#' as the last level", topic)
+		}
+
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("topic filter %q can only use '+' as a full level", topic)
+		}
+	}
+
+	return nil
+}
+
+// MatchTopic returns true if the topic matches the topic filter (with '+' and '#' wildcards)
+func MatchTopic(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for i, filterLevel := range filterLevels {
+		if filterLevel == "#" {
+			return true
+		}
+
+		if i >= len(topicLevels) {
+			return false
+		}
+
+		if filterLevel != "+" && filterLevel != topicLevels[i] {
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,131 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicLabeler(t *testing.T) {
+	cases := []struct {
+		testDescription string
+		depth           int
+		maxLabels       int
+		topics          []string
+		expectedLabels  []string
+	}{
+		{
+			testDescription: "Full topic is used without depth",
+			depth:           0,
+			maxLabels:       10,
+			topics:          []string{"devices/a/log", "devices/b/log"},
+			expectedLabels:  []string{"devices/a/log", "devices/b/log"},
+		},
+		{
+			testDescription: "Topic is shortened to depth",
+			depth:           2,
+			maxLabels:       10,
+			topics:          []string{"devices/a/log", "devices/a/debug", "devices"},
+			expectedLabels:  []string{"devices/a", "devices/a", "devices"},
+		},
+		{
+			testDescription: "Topics above max labels are folded into other",
+			depth:           0,
+			maxLabels:       2,
+			topics:          []string{"a", "b", "c", "a", "d"},
+			expectedLabels:  []string{"a", "b", "__other__", "a", "__other__"},
+		},
+		{
+			testDescription: "Topic named other isn't folded into other",
+			depth:           1,
+			maxLabels:       1,
+			topics:          []string{"other/a", "devices/a"},
+			expectedLabels:  []string{"other", "__other__"},
+		},
+		{
+			testDescription: "Default max labels is used without max labels",
+			depth:           0,
+			maxLabels:       0,
+			topics:          []string{"a", "b"},
+			expectedLabels:  []string{"a", "b"},
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		labeler := newTopicLabeler(c.depth, c.maxLabels)
+		for j, topic := range c.topics {
+			require.Equal(t, c.expectedLabels[j], labeler.label(topic))
+		}
+	}
+}
+
+func TestValidateTopicFilter(t *testing.T) {
+	cases := []struct {
+		testDescription     string
+		topic               string
+		expectedErrContains string
+	}{
+		{
+			testDescription:     "Topic without wildcards",
+			topic:               "devices/device-1/logs",
+			expectedErrContains: "",
+		},
+		{
+			testDescription:     "Topic with wildcards",
+			topic:               "devices/+/logs/#",
+			expectedErrContains: "",
+		},
+		{
+			testDescription:     "Empty topic",
+			topic:               "",
+			expectedErrContains: "topic filter can't be empty",
+		},
+		{
+			testDescription:     "Multi level wildcard not last",
+			topic:               "devices/#/logs",
+			expectedErrContains: "can only use '#' as the last level",
+		},
+		{
+			testDescription:     "Single level wildcard not a full level",
+			topic:               "devices/device-+/logs",
+			expectedErrContains: "can only use '+' as a full level",
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s", i, c.testDescription)
+
+		err := ValidateTopicFilter(c.topic)
+		if c.expectedErrContains == "" {
+			require.NoError(t, err)
+			continue
+		}
+
+		require.ErrorContains(t, err, c.expectedErrContains)
+	}
+}
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		filter        string
+		topic         string
+		expectedMatch bool
+	}{
+		{filter: "devices/device-1/logs", topic: "devices/device-1/logs", expectedMatch: true},
+		{filter: "devices/device-1/logs", topic: "devices/device-2/logs", expectedMatch: false},
+		{filter: "devices/+/logs", topic: "devices/device-1/logs", expectedMatch: true},
+		{filter: "devices/+/logs", topic: "devices/device-1/metrics", expectedMatch: false},
+		{filter: "devices/+", topic: "devices/device-1/logs", expectedMatch: false},
+		{filter: "devices/#", topic: "devices/device-1/logs", expectedMatch: true},
+		{filter: "devices/#", topic: "devices", expectedMatch: true},
+		{filter: "#", topic: "devices/device-1/logs", expectedMatch: true},
+		{filter: "devices/device-1/logs/debug", topic: "devices/device-1/logs", expectedMatch: false},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: %s matching %s", i, c.filter, c.topic)
+		require.Equal(t, c.expectedMatch, MatchTopic(c.filter, c.topic))
+	}
+}
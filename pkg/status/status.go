@@ -1,60 +1,244 @@
 package status
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"time"
+	"strings"
+)
+
+const (
+	// OutputSplit writes warnings and errors to stderr and the rest to stdout
+	OutputSplit = "split"
+	// OutputStdout writes all status messages to stdout
+	OutputStdout = "stdout"
+	// OutputStderr writes all status messages to stderr, keeping stdout for the device messages only
+	OutputStderr = "stderr"
+	// OutputFile appends all status messages to OutputFile
+	OutputFile = "file"
+	// OutputDisabled doesn't write any status messages
+	OutputDisabled = "disabled"
+
+	// TagKey is the field added to all status messages when Tag is enabled, to tell them apart from device messages
+	TagKey = "mqtt_log_stdout_status"
 )
 
 // Options takes the input configuration for the status client
 type Options struct {
 	ClientID string
-}
-type statusMessage struct {
-	Timestamp    time.Time `json:"timestamp"`
-	ClientID     string    `json:"client_id"`
-	Message      string    `json:"message"`
-	ErrorMessage string    `json:"error,omitempty"`
+	// Level is the minimum level printed: debug, info (default), warn or error
+	Level string
+	// Format is the output format: json (default) or text
+	Format string
+	// Output is where status messages are written: split (default), stdout, stderr, file or disabled
+	Output string
+	// OutputFile is the file status messages are appended to when Output is file
+	OutputFile string
+	// Tag adds the field TagKey to all status messages
+	Tag bool
+	// Stdout and Stderr default to os.Stdout and os.Stderr
+	Stdout io.Writer
+	Stderr io.Writer
 }
 
 type client struct {
-	clientID string
+	logger *slog.Logger
+	level  *slog.LevelVar
 }
 
-// Client interface
+// Client interface, args are key/value pairs (or slog.Attr) added as fields to the status message
 type Client interface {
-	Print(m string, e error)
+	Debug(m string, args ...any)
+	Info(m string, args ...any)
+	Warn(m string, args ...any)
+	Error(m string, args ...any)
+}
+
+// LevelSetter is implemented by the Client returned by NewClient, to change the level when the config is reloaded
+type LevelSetter interface {
+	// SetLevel changes the minimum level printed: debug, info, warn or error
+	SetLevel(level string) error
 }
 
 // NewClient returns a Client interface
-func NewClient(opts Options) Client {
+func NewClient(opts Options) (Client, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout := opts.Stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+
+	stderr := opts.Stderr
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+
+	levelVar := &slog.LevelVar{}
+	levelVar.Set(level)
+
+	handlerOpts := &slog.HandlerOptions{
+		Level:       levelVar,
+		ReplaceAttr: replaceAttr,
+	}
+
+	var newHandler func(w io.Writer, opts *slog.HandlerOptions) slog.Handler
+	switch opts.Format {
+	case "", "json":
+		newHandler = func(w io.Writer, opts *slog.HandlerOptions) slog.Handler { return slog.NewJSONHandler(w, opts) }
+	case "text":
+		newHandler = func(w io.Writer, opts *slog.HandlerOptions) slog.Handler { return slog.NewTextHandler(w, opts) }
+	default:
+		return nil, fmt.Errorf("log format allowed to be json or text, received: %s", opts.Format)
+	}
+
+	var handler slog.Handler
+	switch opts.Output {
+	case "", OutputSplit:
+		handler = &levelSplitHandler{
+			stdout: newHandler(stdout, handlerOpts),
+			stderr: newHandler(stderr, handlerOpts),
+		}
+	case OutputStdout:
+		handler = newHandler(stdout, handlerOpts)
+	case OutputStderr:
+		handler = newHandler(stderr, handlerOpts)
+	case OutputFile:
+		// The file is kept open for the lifetime of the application
+		file, err := os.OpenFile(opts.OutputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open status output file %q: %w", opts.OutputFile, err)
+		}
+
+		handler = newHandler(file, handlerOpts)
+	case OutputDisabled:
+		handler = disabledHandler{}
+	default:
+		return nil, fmt.Errorf("status output allowed to be split, stdout, stderr, file or disabled, received: %s", opts.Output)
+	}
+
+	logger := slog.New(handler)
+	if opts.Tag {
+		logger = logger.With(TagKey, true)
+	}
+
 	return &client{
-		clientID: opts.ClientID,
+		logger: logger.With("client_id", opts.ClientID),
+		level:  levelVar,
+	}, nil
+}
+
+// SetLevel changes the minimum level printed, the level is kept if it isn't valid
+func (s *client) SetLevel(level string) error {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	s.level.Set(l)
+
+	return nil
+}
+
+// ParseLevel returns the slog level for debug, info, warn or error (info if empty)
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("log level allowed to be debug, info, warn or error, received: %s", level)
 	}
 }
 
-// Print prints messages to stdout or stderr
-func (s *client) Print(m string, e error) {
-	output := os.Stdout
-	errMsg := ""
-	if e != nil {
-		errMsg = e.Error()
-		output = os.Stderr
+// Debug prints messages useful when debugging, like connection attempts
+func (s *client) Debug(m string, args ...any) {
+	s.logger.Debug(m, args...)
+}
+
+// Info prints lifecycle messages
+func (s *client) Info(m string, args ...any) {
+	s.logger.Info(m, args...)
+}
+
+// Warn prints messages about problems that the client recovers from
+func (s *client) Warn(m string, args ...any) {
+	s.logger.Warn(m, args...)
+}
+
+// Error prints messages about problems that the client can't recover from
+func (s *client) Error(m string, args ...any) {
+	s.logger.Error(m, args...)
+}
+
+// replaceAttr keeps the field names used before the status messages were backed by slog
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
 	}
 
-	status := statusMessage{
-		Timestamp:    time.Now(),
-		ClientID:     s.clientID,
-		Message:      m,
-		ErrorMessage: errMsg,
+	switch a.Key {
+	case slog.TimeKey:
+		a.Key = "timestamp"
+	case slog.MessageKey:
+		a.Key = "message"
+	case slog.LevelKey:
+		a.Value = slog.StringValue(strings.ToLower(a.Value.String()))
 	}
 
-	res, err := json.Marshal(status)
-	if err != nil {
-		res = []byte(fmt.Sprintf("{\"timestamp\":\"%s\",\"client_id\":\"%s\",\"message\":\"\",\"error\":\"json.Marshal(status) failed: %s\"}", status.Timestamp, status.ClientID, err.Error()))
-		output = os.Stderr
+	return a
+}
+
+// levelSplitHandler writes warnings and errors to stderr and the rest to stdout
+type levelSplitHandler struct {
+	stdout slog.Handler
+	stderr slog.Handler
+}
+
+func (h *levelSplitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler(level).Enabled(ctx, level)
+}
+
+func (h *levelSplitHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler(r.Level).Handle(ctx, r)
+}
+
+func (h *levelSplitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelSplitHandler{
+		stdout: h.stdout.WithAttrs(attrs),
+		stderr: h.stderr.WithAttrs(attrs),
+	}
+}
+
+func (h *levelSplitHandler) WithGroup(name string) slog.Handler {
+	return &levelSplitHandler{
+		stdout: h.stdout.WithGroup(name),
+		stderr: h.stderr.WithGroup(name),
 	}
+}
 
-	fmt.Fprintf(output, "%s\n", string(res))
+func (h *levelSplitHandler) handler(level slog.Level) slog.Handler {
+	if level >= slog.LevelWarn {
+		return h.stderr
+	}
+
+	return h.stdout
 }
+
+// disabledHandler drops all status messages
+type disabledHandler struct{}
+
+func (disabledHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (disabledHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h disabledHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h disabledHandler) WithGroup(string) slog.Handler           { return h }
@@ -1,41 +1,34 @@
 package status
 
 import (
+	"bytes"
 	"fmt"
-	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
 
 func TestPrint(t *testing.T) {
-	statusClient := NewClient(Options{ClientID: "fake"})
-
-	stdout := os.Stdout
-	defer func() {
-		os.Stdout = stdout
-	}()
-
-	r, w, err := os.Pipe()
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	statusClient, err := NewClient(Options{ClientID: "fake", Stdout: stdout, Stderr: stderr})
 	if err != nil {
 		t.Errorf("Expected err to be nil: %q", err)
 	}
 
-	os.Stdout = w
-	statusClient.Print("fake message", nil)
-	w.Close()
+	statusClient.Info("fake message", "topic", "fake-topic")
 
-	outputBytes, err := io.ReadAll(r)
-	if err != nil {
-		t.Errorf("Expected err to be nil: %q", err)
-	}
-
-	output := string(outputBytes)
+	output := stdout.String()
 
 	if !strings.Contains(output, "\"timestamp\":") {
 		t.Errorf("Expected output to contain '\"timestamp\":' but was: %q", output)
 	}
 
+	if !strings.Contains(output, "\"level\":\"info\"") {
+		t.Errorf("Expected output to contain '\"level\":\"info\"' but was: %q", output)
+	}
+
 	if !strings.Contains(output, "\"client_id\":\"fake\"") {
 		t.Errorf("Expected output to contain '\"client_id\":\"fake\"' but was: %q", output)
 	}
@@ -43,45 +36,243 @@ func TestPrint(t *testing.T) {
 	if !strings.Contains(output, "\"message\":\"fake message\"") {
 		t.Errorf("Expected output to contain '\"message\":\"fake message\"' but was: %q", output)
 	}
+
+	if !strings.Contains(output, "\"topic\":\"fake-topic\"") {
+		t.Errorf("Expected output to contain '\"topic\":\"fake-topic\"' but was: %q", output)
+	}
+
+	if stderr.Len() != 0 {
+		t.Errorf("Expected stderr to be empty but was: %q", stderr.String())
+	}
 }
 
 func TestPrintErr(t *testing.T) {
-	statusClient := NewClient(Options{ClientID: "fake"})
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	statusClient, err := NewClient(Options{ClientID: "fake", Stdout: stdout, Stderr: stderr})
+	if err != nil {
+		t.Errorf("Expected err to be nil: %q", err)
+	}
+
+	statusClient.Error("fake message", "error", fmt.Errorf("fake error"))
+
+	output := stderr.String()
+
+	if !strings.Contains(output, "\"level\":\"error\"") {
+		t.Errorf("Expected output to contain '\"level\":\"error\"' but was: %q", output)
+	}
+
+	if !strings.Contains(output, "\"message\":\"fake message\"") {
+		t.Errorf("Expected output to contain '\"message\":\"fake message\"' but was: %q", output)
+	}
+
+	if !strings.Contains(output, "\"error\":\"fake error\"") {
+		t.Errorf("Expected output to contain '\"error\":\"fake error\"' but was: %q", output)
+	}
+
+	if stdout.Len() != 0 {
+		t.Errorf("Expected stdout to be empty but was: %q", stdout.String())
+	}
+}
+
+func TestLevelAndFormat(t *testing.T) {
+	cases := []struct {
+		level               string
+		format              string
+		expectedStdout      string
+		expectedErrContains string
+	}{
+		{
+			level:          "debug",
+			format:         "text",
+			expectedStdout: "level=debug message=\"fake debug\" client_id=fake attempt=1\nlevel=info message=\"fake info\" client_id=fake\n",
+		},
+		{
+			level:          "info",
+			format:         "text",
+			expectedStdout: "level=info message=\"fake info\" client_id=fake\n",
+		},
+		{
+			level:          "warn",
+			format:         "json",
+			expectedStdout: "",
+		},
+		{
+			level:               "trace",
+			format:              "json",
+			expectedErrContains: "log level allowed to be debug, info, warn or error, received: trace",
+		},
+		{
+			level:               "info",
+			format:              "yaml",
+			expectedErrContains: "log format allowed to be json or text, received: yaml",
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: level %s and format %s", i, c.level, c.format)
 
-	stderr := os.Stderr
-	defer func() {
-		os.Stdout = stderr
-	}()
+		stdout := &bytes.Buffer{}
+		statusClient, err := NewClient(Options{ClientID: "fake", Level: c.level, Format: c.format, Stdout: stdout, Stderr: &bytes.Buffer{}})
+		if c.expectedErrContains != "" {
+			if err == nil || !strings.Contains(err.Error(), c.expectedErrContains) {
+				t.Errorf("Expected err to contain '%s' but was: %q", c.expectedErrContains, err)
+			}
+			continue
+		}
 
-	r, w, err := os.Pipe()
+		if err != nil {
+			t.Errorf("Expected err to be nil: %q", err)
+		}
+
+		statusClient.Debug("fake debug", "attempt", 1)
+		statusClient.Info("fake info")
+
+		// The timestamp is removed to be able to compare the output
+		output := stdout.String()
+		lines := strings.SplitAfter(output, "\n")
+		for j, line := range lines {
+			if strings.HasPrefix(line, "timestamp=") {
+				lines[j] = line[strings.Index(line, " ")+1:]
+			}
+		}
+
+		output = strings.Join(lines, "")
+		if output != c.expectedStdout {
+			t.Errorf("Expected stdout to be %q but was: %q", c.expectedStdout, output)
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "status.log")
+
+	cases := []struct {
+		output              string
+		tag                 bool
+		expectedStdout      []string
+		expectedStderr      []string
+		expectedFile        []string
+		expectedErrContains string
+	}{
+		{
+			output:         OutputSplit,
+			expectedStdout: []string{"fake info"},
+			expectedStderr: []string{"fake error"},
+		},
+		{
+			output:         OutputStdout,
+			expectedStdout: []string{"fake info", "fake error"},
+		},
+		{
+			output:         OutputStderr,
+			tag:            true,
+			expectedStderr: []string{"fake info", "fake error", fmt.Sprintf("\"%s\":true", TagKey)},
+		},
+		{
+			output:       OutputFile,
+			expectedFile: []string{"fake info", "fake error"},
+		},
+		{
+			output: OutputDisabled,
+		},
+		{
+			output:              "syslog",
+			expectedErrContains: "status output allowed to be split, stdout, stderr, file or disabled, received: syslog",
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Test iteration %d: output %s", i, c.output)
+
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		statusClient, err := NewClient(Options{ClientID: "fake", Output: c.output, OutputFile: tmpFile, Tag: c.tag, Stdout: stdout, Stderr: stderr})
+		if c.expectedErrContains != "" {
+			if err == nil || !strings.Contains(err.Error(), c.expectedErrContains) {
+				t.Errorf("Expected err to contain '%s' but was: %q", c.expectedErrContains, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Expected err to be nil: %q", err)
+		}
+
+		statusClient.Info("fake info")
+		statusClient.Error("fake error")
+
+		file, err := os.ReadFile(tmpFile)
+		if err != nil && !os.IsNotExist(err) {
+			t.Errorf("Expected err to be nil: %q", err)
+		}
+
+		for name, output := range map[string]struct {
+			actual   string
+			expected []string
+		}{
+			"stdout": {actual: stdout.String(), expected: c.expectedStdout},
+			"stderr": {actual: stderr.String(), expected: c.expectedStderr},
+			"file":   {actual: string(file), expected: c.expectedFile},
+		} {
+			if len(output.expected) == 0 && output.actual != "" {
+				t.Errorf("Expected %s to be empty but was: %q", name, output.actual)
+			}
+
+			for _, expected := range output.expected {
+				if !strings.Contains(output.actual, expected) {
+					t.Errorf("Expected %s to contain '%s' but was: %q", name, expected, output.actual)
+				}
+			}
+		}
+
+		if !c.tag && strings.Contains(stdout.String()+stderr.String(), TagKey) {
+			t.Errorf("Expected output not to contain '%s'", TagKey)
+		}
+
+		os.Remove(tmpFile)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	statusClient, err := NewClient(Options{ClientID: "fake", Level: "info", Output: OutputStdout, Stdout: stdout})
 	if err != nil {
-		t.Errorf("Expected err to be nil: %q", err)
+		t.Fatalf("Expected err to be nil: %q", err)
 	}
 
-	os.Stderr = w
-	statusClient.Print("fake message", fmt.Errorf("fake error"))
-	w.Close()
+	levelSetter, ok := statusClient.(LevelSetter)
+	if !ok {
+		t.Fatalf("Expected status client to implement LevelSetter")
+	}
+
+	statusClient.Debug("fake debug message before")
 
-	outputBytes, err := io.ReadAll(r)
+	err = levelSetter.SetLevel("debug")
 	if err != nil {
 		t.Errorf("Expected err to be nil: %q", err)
 	}
 
-	output := string(outputBytes)
+	statusClient.Debug("fake debug message after")
 
-	if !strings.Contains(output, "\"timestamp\":") {
-		t.Errorf("Expected output to contain '\"timestamp\":' but was: %q", output)
+	err = levelSetter.SetLevel("trace")
+	if err == nil {
+		t.Errorf("Expected err to be an invalid level error but was nil")
 	}
 
-	if !strings.Contains(output, "\"client_id\":\"fake\"") {
-		t.Errorf("Expected output to contain '\"client_id\":\"fake\"' but was: %q", output)
+	statusClient.Debug("fake debug message after invalid level")
+
+	output := stdout.String()
+
+	if strings.Contains(output, "fake debug message before") {
+		t.Errorf("Expected output not to contain the debug message printed before the level was changed but was: %q", output)
 	}
 
-	if !strings.Contains(output, "\"message\":\"fake message\"") {
-		t.Errorf("Expected output to contain '\"message\":\"fake message\"' but was: %q", output)
+	if !strings.Contains(output, "fake debug message after") {
+		t.Errorf("Expected output to contain the debug message printed after the level was changed but was: %q", output)
 	}
 
-	if !strings.Contains(output, "\"error\":\"fake error\"") {
-		t.Errorf("Expected output to contain '\"error\":\"fake error\"' but was: %q", output)
+	if !strings.Contains(output, "fake debug message after invalid level") {
+		t.Errorf("Expected the level to be kept after an invalid level but was: %q", output)
 	}
 }
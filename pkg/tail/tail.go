@@ -0,0 +1,186 @@
+package tail
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/xenitab/mqtt-log-stdout/pkg/mqtt"
+)
+
+// ErrTooManyClients is returned by Subscribe when the max number of tail clients is reached
+var ErrTooManyClients = fmt.Errorf("too many tail clients")
+
+// Options takes the input configuration for the tail broker
+type Options struct {
+	// BufferSize is the number of messages buffered per client (before filtering), slow clients are disconnected when it is full
+	BufferSize int
+	// MaxClients is the max number of concurrent tail clients
+	MaxClients int
+	// Registerer is used to register the tail metrics, they aren't registered if nil
+	Registerer prometheus.Registerer
+}
+
+// Message is a received message sent to tail clients
+type Message struct {
+	Topic    string    `json:"topic"`
+	Payload  string    `json:"payload"`
+	Received time.Time `json:"received"`
+}
+
+// Filter selects the messages sent to a tail client
+type Filter struct {
+	// Topic is an MQTT topic filter (with '+' and '#' wildcards), all topics match if empty
+	Topic string
+	// Payload matches the payload, all payloads match if nil
+	Payload *regexp.Regexp
+}
+
+// Match returns true if the message matches the filter
+func (filter Filter) Match(message Message) bool {
+	if filter.Topic != "" && !mqtt.MatchTopic(filter.Topic, message.Topic) {
+		return false
+	}
+
+	if filter.Payload != nil && !filter.Payload.MatchString(message.Payload) {
+		return false
+	}
+
+	return true
+}
+
+// Subscriber receives all messages until Done() is closed, the messages are filtered by the receiver using Match()
+// to keep the filtering out of the message handler
+type Subscriber struct {
+	filter   Filter
+	messages chan Message
+	done     chan struct{}
+	closed   bool
+	// Slow is true if the subscriber was disconnected because its buffer was full
+	slow bool
+}
+
+// Messages returns the channel receiving messages, including the ones not matching the filter
+func (subscriber *Subscriber) Messages() <-chan Message {
+	return subscriber.messages
+}
+
+// Match returns true if the message matches the filter of the subscriber
+func (subscriber *Subscriber) Match(message Message) bool {
+	return subscriber.filter.Match(message)
+}
+
+// Done is closed when the subscriber is disconnected
+func (subscriber *Subscriber) Done() <-chan struct{} {
+	return subscriber.done
+}
+
+// Broker fans out received messages to the tail clients without ever blocking the caller
+type Broker struct {
+	bufferSize  int
+	maxClients  int
+	mu          sync.Mutex
+	subscribers map[*Subscriber]struct{}
+	clients     prometheus.Gauge
+	slowClients prometheus.Counter
+}
+
+// NewBroker returns a tail broker
+func NewBroker(opts Options) *Broker {
+	factory := promauto.With(opts.Registerer)
+
+	return &Broker{
+		bufferSize:  opts.BufferSize,
+		maxClients:  opts.MaxClients,
+		subscribers: make(map[*Subscriber]struct{}),
+		clients: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "tail_clients",
+			Help: "The number of connected tail clients",
+		}),
+		slowClients: factory.NewCounter(prometheus.CounterOpts{
+			Name: "tail_slow_client_disconnects_total",
+			Help: "The total number of tail clients disconnected because they didn't keep up",
+		}),
+	}
+}
+
+// Observe sends the message to all subscribers without blocking, subscribers with a full buffer are disconnected.
+// It is called by the message handler, which is why the filtering is done by the subscribers.
+func (broker *Broker) Observe(topic string, payload []byte, received time.Time) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	if len(broker.subscribers) == 0 {
+		return
+	}
+
+	message := Message{
+		Topic:    topic,
+		Payload:  string(payload),
+		Received: received,
+	}
+
+	for subscriber := range broker.subscribers {
+		select {
+		case subscriber.messages <- message:
+		default:
+			subscriber.slow = true
+			broker.slowClients.Inc()
+			broker.remove(subscriber)
+		}
+	}
+}
+
+// Subscribe returns a new subscriber, Unsubscribe needs to be called when it is no longer used
+func (broker *Broker) Subscribe(filter Filter) (*Subscriber, error) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	if broker.maxClients > 0 && len(broker.subscribers) >= broker.maxClients {
+		return nil, ErrTooManyClients
+	}
+
+	subscriber := &Subscriber{
+		filter:   filter,
+		messages: make(chan Message, broker.bufferSize),
+		done:     make(chan struct{}),
+	}
+
+	broker.subscribers[subscriber] = struct{}{}
+	broker.clients.Set(float64(len(broker.subscribers)))
+
+	return subscriber, nil
+}
+
+// Clients returns the number of connected tail clients
+func (broker *Broker) Clients() int {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	return len(broker.subscribers)
+}
+
+// Unsubscribe disconnects the subscriber, it returns true if it was disconnected earlier because it was too slow
+func (broker *Broker) Unsubscribe(subscriber *Subscriber) bool {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	broker.remove(subscriber)
+
+	return subscriber.slow
+}
+
+// remove needs to be called with the lock held
+func (broker *Broker) remove(subscriber *Subscriber) {
+	if subscriber.closed {
+		return
+	}
+
+	subscriber.closed = true
+	close(subscriber.done)
+	delete(broker.subscribers, subscriber)
+	broker.clients.Set(float64(len(broker.subscribers)))
+}
@@ -0,0 +1,61 @@
+package tail
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestBroker(t *testing.T) {
+	broker := NewBroker(Options{
+		BufferSize: 2,
+		MaxClients: 2,
+	})
+
+	// Messages are dropped without subscribers
+	broker.Observe("devices/device-1/logs", []byte("fake message"), time.Now())
+
+	all, err := broker.Subscribe(Filter{})
+	require.NoError(t, err)
+
+	filtered, err := broker.Subscribe(Filter{Topic: "devices/+/logs", Payload: regexp.MustCompile("error")})
+	require.NoError(t, err)
+	require.Equal(t, float64(2), testutil.ToFloat64(broker.clients))
+
+	_, err = broker.Subscribe(Filter{})
+	require.ErrorIs(t, err, ErrTooManyClients)
+
+	broker.Observe("devices/device-1/logs", []byte("fake error"), time.Now())
+	broker.Observe("devices/device-1/metrics", []byte("fake error"), time.Now())
+
+	// The messages are filtered by the receiver
+	require.True(t, filtered.Match(<-filtered.Messages()))
+	require.False(t, filtered.Match(<-filtered.Messages()))
+	require.Len(t, filtered.Messages(), 0)
+	require.False(t, filtered.Match(Message{Topic: "devices/device-1/logs", Payload: "fake message"}))
+
+	// The subscriber not receiving messages is disconnected when its buffer is full, without affecting the others
+	broker.Observe("devices/device-1/logs", []byte("fake message"), time.Now())
+	<-all.Done()
+	require.Equal(t, float64(1), testutil.ToFloat64(broker.slowClients))
+	require.Equal(t, float64(1), testutil.ToFloat64(broker.clients))
+	require.True(t, broker.Unsubscribe(all))
+
+	select {
+	case <-filtered.Done():
+		t.Fatal("Expected the filtered subscriber to still be connected")
+	default:
+	}
+
+	require.False(t, broker.Unsubscribe(filtered))
+	<-filtered.Done()
+	require.Equal(t, float64(0), testutil.ToFloat64(broker.clients))
+}
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}